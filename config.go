@@ -1,5 +1,7 @@
 package cucumber
 
+import "time"
+
 // Configuration options
 type Config struct {
 	// Language (default "en")
@@ -14,11 +16,19 @@ type Config struct {
 	// with particular seed
 	Seed uint64
 
-	// Max number of steps to run in parallel
-	// 0 (default) - unbound
-	// Use 1 to disable parallel execution
+	// Max number of scenarios in flight at once, the lower of
+	// Concurrency and ScenarioConcurrency applies
+	// 0 (default) - bound by ScenarioConcurrency only
+	//
+	// Deprecated: use ScenarioConcurrency. cucumber-engine runs one step
+	// per scenario at a time, so steps are not bound separately.
 	Concurrency uint64
 
+	// Max number of scenarios in flight at once
+	// 0 (default) - runtime.GOMAXPROCS(0)
+	// Use 1 to disable parallel execution
+	ScenarioConcurrency uint64
+
 	// Stop on first failure
 	FailFast bool
 
@@ -28,6 +38,18 @@ type Config struct {
 	// Fail on pending or undefined steps
 	Strict bool
 
+	// Max duration of a single step, 0 (default) - unbound.
+	// Can be overridden per step definition with cucumber.WithStepTimeout
+	// and per scenario with @timeout(duration) tag
+	StepTimeout time.Duration
+
+	// Number of times to retry failed scenarios, 0 (default) - no retries.
+	// Can be overridden per scenario with @retry(n) tag
+	Retry uint64
+
+	// Fail when scenarios pass only after a retry
+	StrictFlaky bool
+
 	// Filter scenarios by tags
 	TagExpression string
 
@@ -36,4 +58,12 @@ type Config struct {
 
 	// By default it will look in features/ dir
 	Paths []string
+
+	// Snippets for undefined steps use Cucumber Expressions by default,
+	// use cucumber.SnippetRegularExpression for regular expressions
+	SnippetPattern SnippetPatternType
+
+	// Snippets define steps with closures by default,
+	// use cucumber.SnippetFunction for named functions
+	SnippetStyle SnippetStyleType
 }
@@ -1,10 +1,21 @@
 package cucumber_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	messages "github.com/cucumber/cucumber-messages-go/v3"
 	"github.com/pranas/cucumber-go"
 
 	"github.com/stretchr/testify/assert"
@@ -39,6 +50,64 @@ func TestRun(t *testing.T) {
 	assert.Equal(t, 4, summary.StepsTotal)
 	assert.Equal(t, 4, summary.StepsPassed)
 
+	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary})
+	require.NoError(t, err)
+
+	s.DefineStep(`you concat {string} and {string}`, concat)
+	s.DefineStep(`you should have {string}`, matchOutput)
+
+	exitCode = s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.True(t, summary.Success)
+	assert.Equal(t, 2, summary.TestCasesTotal)
+	assert.Equal(t, 2, summary.TestCasesPassed)
+	assert.Equal(t, 4, summary.StepsTotal)
+	assert.Equal(t, 4, summary.StepsPassed)
+
+	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary})
+	require.NoError(t, err)
+
+	s.DefineParameterType("quoted", []string{`"[^"]*"`}, func(captures ...string) (interface{}, error) {
+		return []byte(strings.Trim(captures[0], `"`)), nil
+	})
+	s.DefineStep(`you concat {quoted} and {quoted}`, func(tc cucumber.TestCase, a, b []byte) error {
+		tc.Set("state", string(a) + string(b))
+		return nil
+	})
+	s.DefineStep(`you should have {string}`, matchOutput)
+
+	exitCode = s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.True(t, summary.Success)
+	assert.Equal(t, 4, summary.StepsPassed)
+
+	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary})
+	require.NoError(t, err)
+
+	s.DefineStep(`you concat {color} and {color}`, concat)
+
+	exitCode = s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.False(t, summary.Success)
+
+	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary})
+	require.NoError(t, err)
+
+	s.DefineStep(`you concat {string} and {string}`, concat)
+	s.DefineStep(`you should have {string}`, func(tc cucumber.TestCase, expected int) error {
+		return nil
+	})
+
+	exitCode = s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.False(t, summary.Success)
+	assert.Equal(t, 2, summary.StepsPassed)
+	assert.Equal(t, 2, summary.StepsFailed)
+
 	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
 	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary}, "features/concat.feature:6")
 	require.NoError(t, err)
@@ -69,6 +138,21 @@ func TestRun(t *testing.T) {
 	assert.Equal(t, 2, summary.StepsPassed)
 }
 
+func TestSnippets(t *testing.T) {
+	var out bytes.Buffer
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter: cucumber.NewSummaryFormatter(&out)})
+	require.NoError(t, err)
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+
+	snippet := "s.DefineStep(`you concat {string} and {string}`, func(tc cucumber.TestCase, arg1 string, arg2 string) error {\n" +
+		"\treturn cucumber.ErrPending\n" +
+		"})"
+	assert.Equal(t, 1, strings.Count(out.String(), snippet))
+	assert.Contains(t, out.String(), "s.DefineStep(`you should have {string}`")
+}
+
 func concat(tc cucumber.TestCase, matches ...string) error {
 	tc.Set("state", matches[0] + matches[1])
 	return nil
@@ -82,4 +166,1075 @@ func matchOutput(tc cucumber.TestCase, expected ...string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+func TestStepArguments(t *testing.T) {
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/step_arguments.feature")
+	require.NoError(t, err)
+
+	s.DefineStep(`a doc string`, func(tc cucumber.TestCase, ds *cucumber.DocString) error {
+		tc.Set("content type", ds.ContentType)
+		return nil
+	})
+	s.DefineStep(`content type should be {string}`, func(tc cucumber.TestCase, contentType string) error {
+		if tc.Get("content type") != contentType {
+			return fmt.Errorf("expected %s but got %s", contentType, tc.Get("content type"))
+		}
+		return nil
+	})
+	s.DefineStep(`a data table`, func(tc cucumber.TestCase, dt *cucumber.DataTable) error {
+		tc.Set("rows", len(dt.Rows))
+		return nil
+	})
+	s.DefineStep(`there should be {int} rows`, func(tc cucumber.TestCase, rows int) error {
+		if tc.Get("rows") != rows {
+			return fmt.Errorf("expected %d but got %d", rows, tc.Get("rows"))
+		}
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, 2, summary.TestCasesPassed)
+	assert.Equal(t, 4, summary.StepsPassed)
+
+	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/step_arguments.feature")
+	require.NoError(t, err)
+
+	s.DefineStep(`a doc string`, func(tc cucumber.TestCase, dt *cucumber.DataTable) error {
+		return nil
+	})
+	s.DefineStep(`a data table`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+	s.DefineStep(`content type should be {string}`, func(tc cucumber.TestCase, contentType string) error {
+		return nil
+	})
+	s.DefineStep(`there should be {int} rows`, func(tc cucumber.TestCase, rows int, dt *cucumber.DataTable) error {
+		return nil
+	})
+
+	exitCode = s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 2, summary.TestCasesFailed)
+	assert.Equal(t, 2, summary.StepsFailed)
+	assert.Equal(t, 1, summary.StepsPassed)
+	assert.Equal(t, 1, summary.StepsSkipped)
+}
+
+func TestHooks(t *testing.T) {
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var statuses []cucumber.Status
+
+	s.DefineBefore("@db", func(tc cucumber.TestCase) error {
+		tc.Set("db", true)
+		return nil
+	})
+	s.DefineAfter("", func(tc cucumber.TestCase, result cucumber.ScenarioResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses = append(statuses, result.Status)
+		return nil
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		if tc.Get("db") != true {
+			return errors.New("before hook did not run")
+		}
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		if tc.Get("db") != nil {
+			return errors.New("before hook should not run")
+		}
+		return errors.New("failed")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 1, summary.TestCasesPassed)
+	assert.Equal(t, 1, summary.TestCasesFailed)
+	assert.Equal(t, 2, summary.StepsTotal)
+	assert.ElementsMatch(t, []cucumber.Status{cucumber.StatusPassed, cucumber.StatusFailed}, statuses)
+
+	var out bytes.Buffer
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter: cucumber.NewDotFormatter(&out)}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	s.DefineBefore("@db", func(tc cucumber.TestCase) error {
+		return errors.New("no database")
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+
+	exitCode = s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, out.String(), "H")
+	assert.Contains(t, out.String(), "Error: no database")
+	assert.Contains(t, out.String(), "2 steps (1 passed, 1 skipped)")
+}
+
+func TestTestRunHooks(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary})
+	require.NoError(t, err)
+
+	var calls []string
+
+	s.DefineBeforeAll(func() error {
+		calls = append(calls, "before all")
+		return errors.New("no server")
+	})
+	s.DefineBeforeAll(func() error {
+		calls = append(calls, "second before all")
+		return nil
+	})
+	s.DefineAfterAll(func() error {
+		calls = append(calls, "after all")
+		return nil
+	})
+	s.DefineStep(`you concat {string} and {string}`, concat)
+	s.DefineStep(`you should have {string}`, matchOutput)
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.False(t, summary.Success)
+	assert.Equal(t, []string{"before all", "after all"}, calls)
+	assert.Equal(t, 0, summary.StepsPassed)
+	assert.Equal(t, 4, summary.StepsSkipped)
+	assert.Regexp(t, `Failed hooks:\s+\S+cucumber_test.go:\d+: no server`, out.String())
+
+	summary = cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary})
+	require.NoError(t, err)
+
+	s.DefineAfterAll(func() error {
+		return errors.New("failed to stop server")
+	})
+	s.DefineStep(`you concat {string} and {string}`, concat)
+	s.DefineStep(`you should have {string}`, matchOutput)
+
+	exitCode = s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.False(t, summary.Success)
+	assert.Equal(t, 4, summary.StepsPassed)
+}
+
+func TestStepHooks(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var calls []string
+
+	s.DefineBeforeStep("", func(tc cucumber.TestCase, step cucumber.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, fmt.Sprintf("before %d %s", step.Index, step.Text))
+		return nil
+	})
+	s.DefineAfterStep("not @db", func(tc cucumber.TestCase, step cucumber.Step, result cucumber.StepResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, fmt.Sprintf("after %d %s %s", step.Index, step.Text, result.Status))
+		return errors.New("screenshot failed")
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		return errors.New("failed")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 1, summary.StepsPassed)
+	assert.Equal(t, 1, summary.StepsFailed)
+	assert.ElementsMatch(t, []string{
+		"before 0 a step",
+		"before 0 a failing step",
+		"after 0 a failing step failed",
+	}, calls)
+	assert.Contains(t, out.String(), "Error: failed\n             screenshot failed\n")
+}
+
+func TestStepTimeouts(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary, StepTimeout:20 * time.Millisecond}, "testdata/timeouts.feature")
+	require.NoError(t, err)
+
+	cancelled := make(chan error, 1)
+
+	s.DefineStep(`a slow step`, func(ctx context.Context, tc cucumber.TestCase) error {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return ctx.Err()
+	}, cucumber.WithStepTimeout(5*time.Millisecond))
+	s.DefineStep(`a blocking step`, func(tc cucumber.TestCase) error {
+		select {}
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 3, summary.StepsFailed)
+	assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+
+	output := out.String()
+	assert.Contains(t, output, "step timed out after 5ms")
+	assert.Contains(t, output, "step timed out after 10ms")
+	assert.Contains(t, output, "step timed out after 20ms")
+}
+
+func TestStepTimeoutAbandonsHandler(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/timeouts.feature:2")
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s.DefineStep(`a slow step`, func(tc cucumber.TestCase) error {
+		for {
+			select {
+			case <-stop:
+				return nil
+			default:
+				tc.Set("state", "step")
+				tc.Errorf("late failure")
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}, cucumber.WithStepTimeout(5*time.Millisecond))
+
+	var state interface{}
+	s.DefineAfter("", func(tc cucumber.TestCase, result cucumber.ScenarioResult) error {
+		tc.Set("state", "hook")
+		time.Sleep(20 * time.Millisecond)
+		state = tc.Get("state")
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "hook", state)
+	assert.Contains(t, out.String(), "step timed out after 5ms")
+	assert.NotContains(t, out.String(), "late failure")
+}
+
+func TestTestCaseMetadata(t *testing.T) {
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/metadata.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	scenarios := map[string]string{}
+
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		mu.Lock()
+		defer mu.Unlock()
+		scenarios[tc.ScenarioName()] = fmt.Sprintf("%s %s:%d %v %v %s",
+			tc.FeatureName(), filepath.Base(tc.URI()), tc.Line(), tc.Tags(), tc.Example(), tc.Step().Text)
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, map[string]string{
+		"plain scenario":  "Metadata metadata.feature:5 [@metadata @plain] map[] a step",
+		"outline for foo": "Metadata metadata.feature:14 [@metadata @examples] map[count:1 name:foo] a step",
+	}, scenarios)
+}
+
+type world struct {
+	steps []string
+}
+
+func TestWorld(t *testing.T) {
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/metadata.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var worlds []*world
+
+	s.DefineWorld(func() *world {
+		mu.Lock()
+		defer mu.Unlock()
+		w := &world{}
+		worlds = append(worlds, w)
+		return w
+	})
+	s.DefineStep(`a step`, func(w *world, tc cucumber.TestCase) error {
+		w.steps = append(w.steps, tc.Step().Text)
+		return nil
+	})
+	s.DefineAfter("", func(tc cucumber.TestCase, result cucumber.ScenarioResult) error {
+		if len(tc.World().(*world).steps) != 1 {
+			return errors.New("world is shared")
+		}
+		return nil
+	})
+
+	assert.PanicsWithValue(t, "invalid step definition \"another step\": step handler must accept TestCase or world *cucumber_test.world as the first argument", func() {
+		s.DefineStep(`another step`, func(w *struct{}) error { return nil })
+	})
+	assert.PanicsWithValue(t, "invalid world: world must be defined before steps", func() {
+		s.DefineWorld(func() *world { return &world{} })
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.Len(t, worlds, 2)
+}
+
+func TestNilWorld(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/metadata.feature")
+	require.NoError(t, err)
+
+	s.DefineWorld(func() *world {
+		return nil
+	})
+	s.DefineStep(`a step`, func(w *world, tc cucumber.TestCase) error {
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 2, summary.TestCasesFailed)
+	assert.Contains(t, out.String(), "world factory returned nil *cucumber_test.world")
+	assert.NotContains(t, out.String(), "panicked")
+}
+
+func TestCleanup(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	calls := map[string][]string{}
+	cleanup := func(tc cucumber.TestCase, name string, err error) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[tc.ScenarioName()] = append(calls[tc.ScenarioName()], name)
+			return err
+		}
+	}
+
+	s.DefineAfter("", func(tc cucumber.TestCase, result cucumber.ScenarioResult) error {
+		return cleanup(tc, "after hook", nil)()
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		tc.Cleanup(cleanup(tc, "server", nil))
+		tc.Cleanup(cleanup(tc, "file", errors.New("file is locked")))
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		tc.Cleanup(cleanup(tc, "row", nil))
+		return errors.New("failed")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 2, summary.TestCasesFailed)
+	assert.Equal(t, map[string][]string{
+		"tagged":   {"after hook", "file", "server"},
+		"untagged": {"after hook", "row"},
+	}, calls)
+	assert.Contains(t, out.String(), "file is locked")
+}
+
+type attachmentFormatter struct {
+	cucumber.Formatter
+	attachments []*messages.Attachment
+}
+
+func (af *attachmentFormatter) ProcessMessage(msg *messages.Envelope) {
+	if m, ok := msg.Message.(*messages.Envelope_Attachment); ok {
+		af.attachments = append(af.attachments, m.Attachment)
+	}
+	af.Formatter.ProcessMessage(msg)
+}
+
+func TestAttachments(t *testing.T) {
+	var out bytes.Buffer
+	formatter := &attachmentFormatter{Formatter: cucumber.NewSummaryFormatter(&out)}
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:formatter}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	s.DefineBefore("", func(tc cucumber.TestCase) error {
+		tc.Log("starting %s", tc.ScenarioName())
+		return nil
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		tc.Log("passing")
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		tc.Log("response status %d", 500)
+		tc.Attach([]byte{1, 2, 3}, "image/png")
+		return errors.New("failed")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+
+	var sources []string
+	for _, attachment := range formatter.attachments {
+		sources = append(sources, fmt.Sprintf("%s:%d %s", filepath.Base(attachment.Source.Uri), attachment.Source.Location.Line, attachment.Media.ContentType))
+	}
+	assert.ElementsMatch(t, []string{
+		"hooks.feature:3 text/plain",
+		"hooks.feature:4 text/plain",
+		"hooks.feature:6 text/plain",
+		"hooks.feature:7 text/plain",
+		"hooks.feature:7 image/png",
+	}, sources)
+
+	output := out.String()
+	assert.Contains(t, output, "      Log: starting untagged\n      Log: response status 500\n      Attachment: image/png (3 bytes)\n")
+	assert.NotContains(t, output, "passing")
+}
+
+func TestSkip(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary, Strict:true}, "testdata/skip.feature")
+	require.NoError(t, err)
+
+	s.DefineBefore("@gpu", func(tc cucumber.TestCase) error {
+		return cucumber.Skip("no GPU available")
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+	s.DefineStep(`a skipped step`, func(tc cucumber.TestCase) error {
+		return cucumber.Skip("feature flag is off")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, 1, summary.TestCasesPassed)
+	assert.Equal(t, 2, summary.TestCasesSkipped)
+	assert.Equal(t, 2, summary.StepsPassed)
+	assert.Equal(t, 3, summary.StepsSkipped)
+
+	output := out.String()
+	assert.Contains(t, output, "Skipped scenarios:")
+	assert.Contains(t, output, "    a skipped step # ")
+	assert.Contains(t, output, "      Reason: feature flag is off\n")
+	assert.Contains(t, output, "      Reason: no GPU available\n")
+	assert.Contains(t, output, "3 scenarios (1 passed, 2 skipped)")
+}
+
+func TestSoftAssertions(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		tc.Errorf("expected status %d but got %d", 200, 500)
+		tc.Errorf("expected name %q but got %q", "foo", "")
+		return errors.New("body is empty")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 1, summary.StepsFailed)
+	assert.Contains(t, out.String(), `      Error: expected status 200 but got 500
+             expected name "foo" but got ""
+             body is empty
+`)
+}
+
+func TestTestify(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/hooks.feature")
+	require.NoError(t, err)
+
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		require.Equal(tc, 1, 1)
+		return nil
+	})
+	s.DefineStep(`a failing step`, func(tc cucumber.TestCase) error {
+		assert.Equal(tc, "foo", "bar", "name")
+		require.Equal(tc, 200, 500, "status")
+		return errors.New("not reached")
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 1, summary.StepsPassed)
+	assert.Equal(t, 1, summary.StepsFailed)
+
+	output := out.String()
+	assert.Contains(t, output, "Messages:   \tname")
+	assert.Contains(t, output, "Messages:   \tstatus")
+	assert.NotContains(t, output, "not reached")
+}
+
+func TestFixtures(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/metadata.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var calls []string
+
+	s.DefineFixture("server", func() (interface{}, func() error, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, "start")
+		return "http://localhost", func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "stop")
+			return errors.New("server is busy")
+		}, nil
+	})
+	s.DefineAfterAll(func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, "after all")
+		return nil
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		url, err := tc.Fixture("server")
+		if err != nil {
+			return err
+		}
+		if url != "http://localhost" {
+			return fmt.Errorf("unexpected url %v", url)
+		}
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 2, summary.StepsPassed)
+	assert.Equal(t, []string{"start", "after all", "stop"}, calls)
+	assert.Contains(t, out.String(), "Failed hooks:")
+	assert.Regexp(t, `cucumber_test.go:\d+: server is busy`, out.String())
+}
+
+func TestLockTags(t *testing.T) {
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary, ScenarioConcurrency:4}, "testdata/locks.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	running := map[string]bool{}
+	maxRunning := 0
+	var violations []string
+
+	s.DefineStep(`a slow step`, func(tc cucumber.TestCase) error {
+		name := tc.ScenarioName()
+
+		mu.Lock()
+		for other := range running {
+			if name == "serial" || other == "serial" {
+				violations = append(violations, name+" with "+other)
+			}
+			if strings.HasPrefix(name, "db") && strings.HasPrefix(other, "db") {
+				violations = append(violations, name+" with "+other)
+			}
+		}
+		running[name] = true
+		if len(running) > maxRunning {
+			maxRunning = len(running)
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		delete(running, name)
+		mu.Unlock()
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, 6, summary.TestCasesPassed)
+	assert.Empty(t, violations)
+	assert.True(t, maxRunning > 1)
+}
+
+func TestConcurrency(t *testing.T) {
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "--scenario-concurrency", "2", "testdata/concurrency.feature")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+
+	s.DefineStep(`a slow step`, func(tc cucumber.TestCase) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, 4, summary.TestCasesPassed)
+	assert.Equal(t, 2, maxRunning)
+}
+
+type testCaseFormatter struct {
+	cucumber.Formatter
+	started  int
+	finished int
+}
+
+func (tf *testCaseFormatter) ProcessMessage(msg *messages.Envelope) {
+	switch msg.Message.(type) {
+	case *messages.Envelope_TestCaseStarted:
+		tf.started++
+	case *messages.Envelope_TestRunFinished:
+		tf.finished++
+	}
+	tf.Formatter.ProcessMessage(msg)
+}
+
+func TestRetry(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	formatter := &testCaseFormatter{Formatter: summary}
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:formatter, Order:cucumber.OrderDefinition}, "--retry", "1", "testdata/retry.feature")
+	require.NoError(t, err)
+
+	attempts := map[string]int{}
+	beforeAll, afterAll := 0, 0
+
+	s.DefineBeforeAll(func() error {
+		beforeAll++
+		return nil
+	})
+	s.DefineAfterAll(func() error {
+		afterAll++
+		return nil
+	})
+	s.DefineStep(`a flaky step`, func(tc cucumber.TestCase) error {
+		if tc.Get("attempted") != nil {
+			return errors.New("test case state was reused")
+		}
+		tc.Set("attempted", true)
+
+		attempts["flaky"]++
+		if attempts["flaky"] == 1 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	s.DefineStep(`a broken step`, func(tc cucumber.TestCase) error {
+		attempts["broken"]++
+		return errors.New("always broken")
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		attempts["passing"]++
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, map[string]int{"flaky": 2, "broken": 3, "passing": 1}, attempts)
+	assert.Equal(t, 1, beforeAll)
+	assert.Equal(t, 1, afterAll)
+	assert.Equal(t, 6, formatter.started)
+	assert.Equal(t, 1, formatter.finished)
+	assert.Equal(t, 3, summary.TestCasesTotal)
+	assert.Equal(t, 1, summary.TestCasesPassed)
+	assert.Equal(t, 1, summary.TestCasesFlaky)
+	assert.Equal(t, 1, summary.TestCasesFailed)
+
+	output := out.String()
+	assert.Contains(t, output, "Flaky scenarios:\n\n  Scenario: flaky # testdata/retry.feature:2\n      Passed after 2 attempts\n")
+	assert.Equal(t, 1, strings.Count(output, "Error: always broken"))
+	assert.NotContains(t, output, "connection reset")
+	assert.Contains(t, output, "3 scenarios (1 passed, 1 flaky, 1 failed)")
+
+	for _, strictFlaky := range []bool{false, true} {
+		out.Reset()
+		summary = cucumber.NewSummaryFormatter(&out)
+		s, err = cucumber.NewSuite(cucumber.Config{Formatter:summary, Retry:1, StrictFlaky:strictFlaky}, "testdata/retry.feature:2")
+		require.NoError(t, err)
+
+		flaky := 0
+		s.DefineStep(`a flaky step`, func(tc cucumber.TestCase) error {
+			flaky++
+			if flaky == 1 {
+				return errors.New("connection reset")
+			}
+			return nil
+		})
+
+		exitCode = s.Run()
+		assert.Equal(t, strictFlaky, exitCode == 1)
+		assert.Equal(t, !strictFlaky, summary.Success)
+		assert.Equal(t, 1, summary.TestCasesFlaky)
+		assert.NotContains(t, out.String(), "Failed steps:")
+		assert.Contains(t, out.String(), "1 scenarios (1 flaky)")
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary, Concurrency:1, Order:cucumber.OrderDefinition}, "testdata/concurrency.feature")
+	require.NoError(t, err)
+
+	var after []string
+	afterAll := 0
+
+	s.DefineAfter("", func(tc cucumber.TestCase, result cucumber.ScenarioResult) error {
+		after = append(after, tc.ScenarioName())
+		return nil
+	})
+	s.DefineAfterAll(func() error {
+		afterAll++
+		return nil
+	})
+	s.DefineStep(`a slow step`, func(ctx context.Context, tc cucumber.TestCase) error {
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			return err
+		}
+		if err := p.Signal(os.Interrupt); err != nil {
+			return err
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 130, exitCode)
+	assert.False(t, summary.Success)
+	assert.True(t, summary.Interrupted)
+	assert.Equal(t, []string{"first"}, after)
+	assert.Equal(t, 1, afterAll)
+	assert.Equal(t, 1, summary.TestCasesFailed)
+	assert.Equal(t, 3, summary.TestCasesSkipped)
+
+	output := out.String()
+	assert.Contains(t, output, "      Error: step interrupted\n")
+	assert.Contains(t, output, "Interrupted, remaining scenarios were skipped\n")
+	assert.Contains(t, output, "4 scenarios (1 failed, 3 skipped)")
+}
+
+func TestRunContext(t *testing.T) {
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:cucumber.NewSummaryFormatter(ioutil.Discard), Order:cucumber.OrderDefinition, Seed:42}, "--retry", "1", "testdata/retry.feature")
+	require.NoError(t, err)
+
+	flaky := 0
+	s.DefineStep(`a flaky step`, func(tc cucumber.TestCase) error {
+		flaky++
+		if flaky == 1 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	s.DefineStep(`a broken step`, func(tc cucumber.TestCase) error {
+		return errors.New("always broken")
+	})
+
+	result, err := s.RunContext(context.Background())
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.False(t, result.Interrupted)
+	assert.Equal(t, uint64(42), result.Seed)
+	assert.Equal(t, uint64(1), result.Config.Retry)
+	assert.Equal(t, cucumber.Totals{Total: 3, Flaky: 1, Failed: 1, Undefined: 1}, result.ScenarioTotals)
+	assert.Equal(t, cucumber.Totals{Total: 3, Passed: 1, Failed: 1, Undefined: 1}, result.StepTotals)
+	require.Len(t, result.Scenarios, 3)
+
+	scenario := result.Scenarios[0]
+	assert.Equal(t, "flaky", scenario.Name)
+	assert.Equal(t, "Retry", scenario.Feature)
+	assert.Equal(t, "testdata/retry.feature", scenario.URI)
+	assert.Equal(t, 2, scenario.Line)
+	assert.Equal(t, cucumber.StatusPassed, scenario.Status)
+	assert.Equal(t, 2, scenario.Attempts)
+	assert.True(t, scenario.Flaky)
+
+	scenario = result.Scenarios[1]
+	assert.Equal(t, "broken", scenario.Name)
+	assert.Equal(t, []string{"@retry(2)"}, scenario.Tags)
+	assert.Equal(t, cucumber.StatusFailed, scenario.Status)
+	assert.Equal(t, "always broken", scenario.Message)
+	assert.Equal(t, 3, scenario.Attempts)
+	assert.False(t, scenario.Flaky)
+	assert.Equal(t, []cucumber.StepReport{{
+		Text:     "a broken step",
+		URI:      "testdata/retry.feature",
+		Line:     7,
+		Status:   cucumber.StatusFailed,
+		Message:  "always broken",
+		Duration: scenario.Steps[0].Duration,
+	}}, scenario.Steps)
+
+	assert.Equal(t, cucumber.StatusUndefined, result.Scenarios[2].Status)
+
+	s, err = cucumber.NewSuite(cucumber.Config{Formatter:cucumber.NewSummaryFormatter(ioutil.Discard), Concurrency:1}, "testdata/concurrency.feature")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.DefineStep(`a slow step`, func(ctx context.Context, tc cucumber.TestCase) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	result, err = s.RunContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, cucumber.Totals{Total: 4, Failed: 1, Skipped: 3}, result.ScenarioTotals)
+
+	// Scenarios that never finish are not reported as passed
+	assert.Equal(t, cucumber.StatusUnknown, cucumber.ScenarioReport{}.Status)
+	assert.Equal(t, "unknown", cucumber.StatusUnknown.String())
+}
+
+func TestReuse(t *testing.T) {
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:cucumber.NewSummaryFormatter(ioutil.Discard)}, "testdata/concurrency.feature")
+	require.NoError(t, err)
+
+	setups, teardowns := 0, 0
+	s.DefineFixture("db", func() (interface{}, func() error, error) {
+		setups++
+		return "db", func() error {
+			teardowns++
+			return nil
+		}, nil
+	})
+	s.DefineStep(`a slow step`, func(tc cucumber.TestCase) error {
+		_, err := tc.Fixture("db")
+		return err
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		_, err := tc.Fixture("db")
+		return err
+	})
+
+	summary := cucumber.NewSummaryFormatter(ioutil.Discard)
+	exitCode := s.Run(cucumber.WithFormatter(summary))
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, 4, summary.TestCasesPassed)
+
+	result, err := s.RunContext(context.Background(), cucumber.WithPaths("testdata/retry.feature:9"), cucumber.WithSeed(7))
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, uint64(7), result.Seed)
+	assert.Equal(t, cucumber.Totals{Total: 1, Passed: 1}, result.ScenarioTotals)
+
+	result, err = s.RunContext(context.Background(), cucumber.WithPaths("testdata/skip.feature"), cucumber.WithTags("@gpu"))
+	require.NoError(t, err)
+	require.Len(t, result.Scenarios, 1)
+	assert.Equal(t, "skipped by hook", result.Scenarios[0].Name)
+	assert.Equal(t, cucumber.StatusPassed, result.Scenarios[0].Status)
+
+	assert.Equal(t, 3, setups)
+	assert.Equal(t, 3, teardowns)
+
+	result, err = s.RunContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "", result.Config.TagExpression)
+	assert.Equal(t, 4, result.ScenarioTotals.Passed)
+
+	_, err = s.RunContext(context.Background(), cucumber.WithPaths("testdata/missing.feature"))
+	assert.EqualError(t, err, "failed to find features in path: testdata/missing.feature")
+}
+
+func TestRunTestHelper(t *testing.T) {
+	concurrency, _ := strconv.ParseUint(os.Getenv("CUCUMBER_RUN_TEST"), 10, 0)
+	if concurrency == 0 {
+		t.Skip("run by TestRunTest")
+	}
+
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:cucumber.NewSummaryFormatter(ioutil.Discard), ScenarioConcurrency:concurrency}, "testdata/retry.feature", "testdata/skip.feature")
+	require.NoError(t, err)
+
+	s.DefineBefore("@gpu", func(tc cucumber.TestCase) error {
+		return cucumber.Skip("no GPU available")
+	})
+	s.DefineStep(`a flaky step`, func(tc cucumber.TestCase) error {
+		fmt.Println("running flaky")
+		return nil
+	})
+	s.DefineStep(`a broken step`, func(tc cucumber.TestCase) error {
+		fmt.Println("running broken")
+		return errors.New("always broken")
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+
+	s.RunTest(t)
+}
+
+func TestRunTest(t *testing.T) {
+	run := func(concurrency string, pattern string) (string, error) {
+		cmd := exec.Command(os.Args[0], "-test.run", pattern, "-test.v")
+		cmd.Env = append(os.Environ(), "CUCUMBER_RUN_TEST="+concurrency)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	for _, concurrency := range []string{"1", "4"} {
+		out, err := run(concurrency, "TestRunTestHelper")
+		assert.Error(t, err)
+		assert.Contains(t, out, "--- PASS: TestRunTestHelper/Retry/flaky")
+		assert.Contains(t, out, "--- FAIL: TestRunTestHelper/Retry/broken")
+		assert.Contains(t, out, "testdata/retry.feature:7: a broken step: always broken")
+		assert.Contains(t, out, "--- FAIL: TestRunTestHelper/Skip/skipped_by_step")
+		assert.Contains(t, out, "testdata/skip.feature:4: a skipped step: undefined step")
+		assert.Contains(t, out, "--- SKIP: TestRunTestHelper/Skip/skipped_by_hook")
+		assert.Contains(t, out, "no GPU available")
+
+		out, err = run(concurrency, "TestRunTestHelper/Retry/flaky")
+		assert.NoError(t, err, out)
+		assert.Contains(t, out, "--- PASS: TestRunTestHelper/Retry/flaky")
+		assert.Contains(t, out, "running flaky")
+		assert.NotContains(t, out, "running broken")
+		assert.NotContains(t, out, "TestRunTestHelper/Skip")
+	}
+}
+
+func TestRetryError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cucumber")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "retry.feature")
+	require.NoError(t, ioutil.WriteFile(path, []byte("Feature: Retry\n  Scenario: removed\n    Given a step removing its feature\n"), 0644))
+
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:cucumber.NewSummaryFormatter(ioutil.Discard), Retry:1}, path)
+	require.NoError(t, err)
+
+	s.DefineStep(`a step removing its feature`, func(tc cucumber.TestCase) error {
+		os.Remove(path)
+		return errors.New("failed")
+	})
+
+	result, err := s.RunContext(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "retry failed: ")
+	assert.False(t, result.Success)
+	assert.Len(t, result.Errors, 1)
+}
+
+func TestRetryUndefined(t *testing.T) {
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:cucumber.NewSummaryFormatter(ioutil.Discard), Retry:3}, "testdata/retry.feature:9")
+	require.NoError(t, err)
+
+	result, err := s.RunContext(context.Background())
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	require.Len(t, result.Scenarios, 1)
+	assert.Equal(t, cucumber.StatusUndefined, result.Scenarios[0].Status)
+	assert.Equal(t, 1, result.Scenarios[0].Attempts)
+}
+
+func TestInvalidRetryTag(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter:summary}, "testdata/invalid_retry.feature")
+	require.NoError(t, err)
+
+	calls := 0
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		calls++
+		return nil
+	})
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, 1, summary.TestCasesFailed)
+	assert.Contains(t, out.String(), "invalid @retry tag: ")
+}
+
+func TestReuseFormatter(t *testing.T) {
+	var out bytes.Buffer
+	summary := cucumber.NewSummaryFormatter(&out)
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter: summary}, "testdata/retry.feature")
+	require.NoError(t, err)
+
+	s.DefineStep(`a flaky step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+	s.DefineStep(`a broken step`, func(tc cucumber.TestCase) error {
+		return errors.New("always broken")
+	})
+	s.DefineStep(`a step`, func(tc cucumber.TestCase) error {
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		out.Reset()
+
+		exitCode := s.Run()
+		assert.Equal(t, 1, exitCode)
+		assert.Equal(t, 3, summary.TestCasesTotal)
+		assert.Equal(t, 2, summary.TestCasesPassed)
+		assert.Equal(t, 0, summary.TestCasesFlaky)
+		assert.Equal(t, 1, summary.TestCasesFailed)
+		assert.Equal(t, 1, strings.Count(out.String(), "Error: always broken"))
+		assert.Contains(t, out.String(), "3 scenarios (2 passed, 1 failed)")
+	}
+}
+
+func TestSnippetFunctions(t *testing.T) {
+	var out bytes.Buffer
+	s, err := cucumber.NewSuite(cucumber.Config{Formatter: cucumber.NewSummaryFormatter(&out), Order: cucumber.OrderDefinition, SnippetStyle: cucumber.SnippetFunction}, "testdata/snippets.feature")
+	require.NoError(t, err)
+
+	exitCode := s.Run()
+	assert.Equal(t, 1, exitCode)
+
+	assert.Contains(t, out.String(), "\n// testdata/snippets.feature:3 I have 5 cukes\n"+
+		"// testdata/snippets.feature:9 I have 7 cukes\n"+
+		"func iHaveCukes(tc cucumber.TestCase, arg1 int) error {\n"+
+		"\treturn cucumber.ErrPending\n"+
+		"}\n\n"+
+		"s.DefineStep(`I have {int} cukes`, iHaveCukes)\n")
+	assert.Contains(t, out.String(), "\n// testdata/snippets.feature:6 I have 5.5 cukes\n"+
+		"func iHaveCukes2(tc cucumber.TestCase, arg1 float64) error {\n"+
+		"\treturn cucumber.ErrPending\n"+
+		"}\n\n"+
+		"s.DefineStep(`I have {float} cukes`, iHaveCukes2)\n")
+}
@@ -0,0 +1,179 @@
+package cucumber
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+const dataTableTag = "cucumber"
+
+// Returns rows keyed by the header row
+func (dt *DataTable) Maps() []map[string]string {
+	if len(dt.Rows) == 0 {
+		return nil
+	}
+
+	header := dt.Rows[0]
+	maps := make([]map[string]string, 0, len(dt.Rows)-1)
+
+	for _, row := range dt.Rows[1:] {
+		m := make(map[string]string, len(header))
+		for i, key := range header {
+			if i < len(row) {
+				m[key] = row[i]
+			}
+		}
+		maps = append(maps, m)
+	}
+
+	return maps
+}
+
+// Returns table with rows and columns swapped
+func (dt *DataTable) Transpose() *DataTable {
+	transposed := &DataTable{uri: dt.uri}
+
+	for i, row := range dt.Rows {
+		for j, value := range row {
+			for len(transposed.Rows) <= j {
+				transposed.Rows = append(transposed.Rows, make([]string, len(dt.Rows)))
+				transposed.locations = append(transposed.locations, make([]*messages.Location, len(dt.Rows)))
+			}
+			transposed.Rows[j][i] = value
+			transposed.locations[j][i] = dt.location(i, j)
+		}
+	}
+
+	return transposed
+}
+
+// Returns vertical two column table as key/value map, e.g.
+//
+//	| name | John |
+//	| age  | 42   |
+func (dt *DataTable) RowsHash() (map[string]string, error) {
+	m := make(map[string]string, len(dt.Rows))
+
+	for i, row := range dt.Rows {
+		if len(row) != 2 {
+			return nil, dt.errorf(i, 0, "expected 2 columns but got %d", len(row))
+		}
+		m[row[0]] = row[1]
+	}
+
+	return m, nil
+}
+
+// Decodes rows into a slice of structs, header cells are matched with
+// `cucumber:"name"` field tags or case insensitive field names.
+// Values are converted to field types the same way as step arguments.
+func (dt *DataTable) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("data table can only be decoded into a pointer to a slice")
+	}
+
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("data table can not be decoded into %s", slice.Type())
+	}
+
+	if len(dt.Rows) == 0 {
+		return nil
+	}
+
+	fields := make([][]int, len(dt.Rows[0]))
+	for j, column := range dt.Rows[0] {
+		field, ok := findField(structType, column)
+		if !ok {
+			return dt.errorf(0, j, "no field for column %q in %s", column, structType)
+		}
+		fields[j] = field.Index
+	}
+
+	for i, row := range dt.Rows[1:] {
+		elem := reflect.New(structType).Elem()
+
+		for j, value := range row {
+			if j >= len(fields) {
+				return dt.errorf(i+1, j, "row has more cells than header")
+			}
+
+			field := elem.FieldByIndex(fields[j])
+
+			converted, err := convertArgument(value, field.Type())
+			if err != nil {
+				return dt.errorf(i+1, j, "column %q: %s", dt.Rows[0][j], err)
+			}
+
+			field.Set(converted)
+		}
+
+		if elemType.Kind() == reflect.Ptr {
+			elem = elem.Addr()
+		}
+
+		slice.Set(reflect.Append(slice, elem))
+	}
+
+	return nil
+}
+
+func findField(t reflect.Type, column string) (reflect.StructField, bool) {
+	normalized := normalizeFieldName(column)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get(dataTableTag)
+		if tag == "-" {
+			continue
+		}
+
+		if tag == column || (tag == "" && normalizeFieldName(field.Name) == normalized) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func normalizeFieldName(name string) string {
+	name = strings.Replace(name, " ", "", -1)
+	name = strings.Replace(name, "_", "", -1)
+
+	return strings.ToLower(name)
+}
+
+func (dt *DataTable) location(row, column int) *messages.Location {
+	if row >= len(dt.locations) || column >= len(dt.locations[row]) {
+		return nil
+	}
+
+	return dt.locations[row][column]
+}
+
+func (dt *DataTable) errorf(row, column int, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+
+	location := dt.location(row, column)
+	if location == nil {
+		return fmt.Errorf("row %d, column %d: %s", row+1, column+1, message)
+	}
+
+	return fmt.Errorf("%s:%d:%d: %s", dt.uri, location.Line, location.Column, message)
+}
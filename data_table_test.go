@@ -0,0 +1,132 @@
+package cucumber
+
+import (
+	"testing"
+	"time"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDataTable(rows ...[]string) *DataTable {
+	dt := &DataTable{Rows: rows, uri: "a.feature"}
+
+	for i, row := range rows {
+		var locations []*messages.Location
+		for j := range row {
+			locations = append(locations, &messages.Location{Line: uint32(i + 10), Column: uint32(j*10 + 7)})
+		}
+		dt.locations = append(dt.locations, locations)
+	}
+
+	return dt
+}
+
+func TestDataTableMaps(t *testing.T) {
+	dt := newTestDataTable(
+		[]string{"name", "age"},
+		[]string{"John", "42"},
+		[]string{"Jane", "37"},
+	)
+
+	assert.Equal(t, []map[string]string{
+		{"name": "John", "age": "42"},
+		{"name": "Jane", "age": "37"},
+	}, dt.Maps())
+
+	assert.Empty(t, newTestDataTable([]string{"name", "age"}).Maps())
+	assert.Nil(t, newTestDataTable().Maps())
+}
+
+func TestDataTableTranspose(t *testing.T) {
+	dt := newTestDataTable(
+		[]string{"name", "John", "Jane"},
+		[]string{"age", "42", "37"},
+	).Transpose()
+
+	assert.Equal(t, [][]string{
+		{"name", "age"},
+		{"John", "42"},
+		{"Jane", "37"},
+	}, dt.Rows)
+	assert.Equal(t, &messages.Location{Line: 11, Column: 17}, dt.location(1, 1))
+}
+
+func TestDataTableRowsHash(t *testing.T) {
+	m, err := newTestDataTable(
+		[]string{"name", "John"},
+		[]string{"age", "42"},
+	).RowsHash()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "John", "age": "42"}, m)
+
+	_, err = newTestDataTable(
+		[]string{"name", "John"},
+		[]string{"age", "42", "years"},
+	).RowsHash()
+	if assert.Error(t, err) {
+		assert.Equal(t, "a.feature:11:7: expected 2 columns but got 3", err.Error())
+	}
+}
+
+func TestDataTableDecode(t *testing.T) {
+	type person struct {
+		Name     string
+		Age      int
+		Height   float64 `cucumber:"height (m)"`
+		Admin    bool
+		Born     time.Time
+		Timeout  time.Duration
+		Internal string `cucumber:"-"`
+	}
+
+	dt := newTestDataTable(
+		[]string{"name", "age", "height (m)", "admin", "born", "timeout"},
+		[]string{"John", "42", "1.85", "true", "1977-05-25", "5s"},
+	)
+
+	var people []person
+	err := dt.Decode(&people)
+	assert.NoError(t, err)
+	assert.Equal(t, []person{{
+		Name:    "John",
+		Age:     42,
+		Height:  1.85,
+		Admin:   true,
+		Born:    time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+		Timeout: 5 * time.Second,
+	}}, people)
+
+	var pointers []*person
+	err = dt.Decode(&pointers)
+	assert.NoError(t, err)
+	if assert.Len(t, pointers, 1) {
+		assert.Equal(t, "John", pointers[0].Name)
+	}
+
+	err = newTestDataTable(
+		[]string{"name", "age"},
+		[]string{"John", "many"},
+	).Decode(&people)
+	if assert.Error(t, err) {
+		assert.Equal(t, `a.feature:11:17: column "age": cannot convert "many" to int`, err.Error())
+	}
+
+	err = newTestDataTable(
+		[]string{"name", "internal"},
+	).Decode(&people)
+	if assert.Error(t, err) {
+		assert.Equal(t, `a.feature:10:17: no field for column "internal" in cucumber.person`, err.Error())
+	}
+
+	err = dt.Decode(people)
+	if assert.Error(t, err) {
+		assert.Equal(t, "data table can only be decoded into a pointer to a slice", err.Error())
+	}
+
+	var names []string
+	err = dt.Decode(&names)
+	if assert.Error(t, err) {
+		assert.Equal(t, "data table can not be decoded into []string", err.Error())
+	}
+}
@@ -0,0 +1,83 @@
+package cucumber
+
+import (
+	"regexp"
+	"strings"
+
+	cucumberexpressions "github.com/cucumber/cucumber-expressions-go"
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+const (
+	// Built-in {string} parameter type captures quoted text through two
+	// alternative groups which cucumber-engine fails to pass on, so string
+	// parameters are matched with our own single group type instead.
+	quotedStringParameterTypeName = "quoted-string"
+	quotedStringRegexp            = `"[^"\\]*(?:\\.[^"\\]*)*"|'[^'\\]*(?:\\.[^'\\]*)*'`
+
+	escapedParameterPrefix = `\\\\`
+)
+
+// Patterns anchored with ^ or $ are regular expressions,
+// anything else is treated as a Cucumber Expression
+func patternType(pattern string) messages.StepDefinitionPatternType {
+	if strings.HasPrefix(pattern, "^") || strings.HasSuffix(pattern, "$") {
+		return messages.StepDefinitionPatternType_REGULAR_EXPRESSION
+	}
+
+	return messages.StepDefinitionPatternType_CUCUMBER_EXPRESSION
+}
+
+func expressionSource(pattern string, patternType messages.StepDefinitionPatternType) string {
+	if patternType != messages.StepDefinitionPatternType_CUCUMBER_EXPRESSION {
+		return pattern
+	}
+
+	return cucumberexpressions.PARAMETER_REGEXP.ReplaceAllStringFunc(pattern, func(match string) string {
+		if match == "{string}" {
+			return "{" + quotedStringParameterTypeName + "}"
+		}
+		return match
+	})
+}
+
+// Number of arguments cucumber-engine will send for the pattern
+func argumentCount(pattern string, patternType messages.StepDefinitionPatternType) (int, error) {
+	if patternType == messages.StepDefinitionPatternType_CUCUMBER_EXPRESSION {
+		count := 0
+		for _, match := range cucumberexpressions.PARAMETER_REGEXP.FindAllString(pattern, -1) {
+			if !strings.HasPrefix(match, escapedParameterPrefix) {
+				count++
+			}
+		}
+		return count, nil
+	}
+
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nested groups are sent as separate captures of the outer group
+	count := 0
+	for _, group := range cucumberexpressions.NewTreeRegexp(r).GroupBuilder().Children() {
+		if len(group.Children()) > 0 {
+			count += len(group.Children())
+		} else {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func unquote(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+
+	quote := s[:1]
+	s = s[1 : len(s)-1]
+
+	return strings.Replace(s, `\`+quote, quote, -1)
+}
@@ -0,0 +1,49 @@
+package cucumber
+
+import (
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternType(t *testing.T) {
+	assert.Equal(t, messages.StepDefinitionPatternType_REGULAR_EXPRESSION, patternType(`^you have (\d+) cukes$`))
+	assert.Equal(t, messages.StepDefinitionPatternType_REGULAR_EXPRESSION, patternType(`^you have (\d+) cukes`))
+	assert.Equal(t, messages.StepDefinitionPatternType_REGULAR_EXPRESSION, patternType(`you have (\d+) cukes$`))
+	assert.Equal(t, messages.StepDefinitionPatternType_CUCUMBER_EXPRESSION, patternType(`you have {int} cukes`))
+}
+
+func TestExpressionSource(t *testing.T) {
+	assert.Equal(t, `^you concat "([^"]*)"$`, expressionSource(`^you concat "([^"]*)"$`, messages.StepDefinitionPatternType_REGULAR_EXPRESSION))
+	assert.Equal(t, `^{string}$`, expressionSource(`^{string}$`, messages.StepDefinitionPatternType_REGULAR_EXPRESSION))
+	assert.Equal(t, `{quoted-string} and {quoted-string}`, expressionSource(`{string} and {string}`, messages.StepDefinitionPatternType_CUCUMBER_EXPRESSION))
+	assert.Equal(t, `you have {int} \\\\{string}`, expressionSource(`you have {int} \\\\{string}`, messages.StepDefinitionPatternType_CUCUMBER_EXPRESSION))
+}
+
+func TestArgumentCount(t *testing.T) {
+	for pattern, expected := range map[string]int{
+		`you have {int} cukes`:            1,
+		`you concat {string} and {}`:      2,
+		`you have {int} \\\\{string}`:     1,
+		`you have no cukes`:               0,
+		`^you have (\d+) (?:big )?cukes$`: 1,
+		`^(\w+) has (\d+) cukes$`:         2,
+		`^(red|(blue)) cukes$`:            1,
+	} {
+		count, err := argumentCount(pattern, patternType(pattern))
+		assert.NoError(t, err, pattern)
+		assert.Equal(t, expected, count, pattern)
+	}
+
+	_, err := argumentCount(`^you have (\d+ cukes$`, messages.StepDefinitionPatternType_REGULAR_EXPRESSION)
+	assert.Error(t, err)
+}
+
+func TestUnquote(t *testing.T) {
+	assert.Equal(t, "foo", unquote(`"foo"`))
+	assert.Equal(t, "foo", unquote(`'foo'`))
+	assert.Equal(t, `say "hi"`, unquote(`"say \"hi\""`))
+	assert.Equal(t, `it's`, unquote(`'it\'s'`))
+	assert.Equal(t, "", unquote(`""`))
+}
@@ -0,0 +1,99 @@
+package cucumber
+
+import (
+	"fmt"
+	"sync"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Fixture provider returns shared value and optional teardown
+// function run after all scenarios
+type fixtureProviderFunc func() (interface{}, func() error, error)
+
+type fixture struct {
+	Name     string
+	Provider fixtureProviderFunc
+	Location *messages.SourceReference
+
+	once     sync.Once
+	value    interface{}
+	teardown func() error
+	err      error
+}
+
+// Fixtures are initialized on first use, teardowns run in reverse order
+type fixtures struct {
+	definitions map[string]*fixture
+	initialized []*fixture
+	mu          sync.Mutex
+}
+
+func (fs *fixtures) define(name string, fn fixtureProviderFunc) {
+	if fs.definitions == nil {
+		fs.definitions = map[string]*fixture{}
+	}
+
+	// Skip define and suite method defining the fixture
+	fs.definitions[name] = &fixture{
+		Name:     name,
+		Provider: fn,
+		Location: callerLocation(2),
+	}
+}
+
+func (fs *fixtures) get(name string) (interface{}, error) {
+	f, ok := fs.definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("fixture %q is not defined", name)
+	}
+
+	f.once.Do(func() {
+		f.err = call(fmt.Sprintf("fixture %q", name), func() (err error) {
+			f.value, f.teardown, err = f.Provider()
+			if err != nil {
+				return fmt.Errorf("fixture %q: %s", name, err)
+			}
+
+			return nil
+		})
+
+		if f.teardown != nil {
+			fs.mu.Lock()
+			fs.initialized = append(fs.initialized, f)
+			fs.mu.Unlock()
+		}
+	})
+
+	return f.value, f.err
+}
+
+func (fs *fixtures) teardowns() []testRunHookDefinition {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var hooks []testRunHookDefinition
+	for i := len(fs.initialized) - 1; i >= 0; i-- {
+		f := fs.initialized[i]
+		hooks = append(hooks, testRunHookDefinition{
+			Name:     fmt.Sprintf("fixture %q teardown", f.Name),
+			Handler:  f.teardown,
+			Location: f.Location,
+		})
+	}
+	fs.initialized = nil
+
+	return hooks
+}
+
+// Fixtures are initialized again by the next run
+func (fs *fixtures) reset() {
+	for name, f := range fs.definitions {
+		fs.definitions[name] = &fixture{
+			Name:     f.Name,
+			Provider: f.Provider,
+			Location: f.Location,
+		}
+	}
+	fs.initialized = nil
+}
@@ -0,0 +1,59 @@
+package cucumber
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixtures(t *testing.T) {
+	var fs fixtures
+
+	calls := 0
+	fs.define("server", func() (interface{}, func() error, error) {
+		calls++
+		return "http://localhost", func() error { return errors.New("server is busy") }, nil
+	})
+	fs.define("store", func() (interface{}, func() error, error) {
+		return "store", func() error { return nil }, nil
+	})
+	fs.define("broken", func() (interface{}, func() error, error) {
+		return nil, nil, errors.New("connection refused")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := fs.get("server")
+			assert.NoError(t, err)
+			assert.Equal(t, "http://localhost", value)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls)
+
+	_, err := fs.get("store")
+	assert.NoError(t, err)
+
+	_, err = fs.get("broken")
+	if assert.Error(t, err) {
+		assert.Equal(t, `fixture "broken": connection refused`, err.Error())
+	}
+
+	_, err = fs.get("missing")
+	if assert.Error(t, err) {
+		assert.Equal(t, `fixture "missing" is not defined`, err.Error())
+	}
+
+	teardowns := fs.teardowns()
+	if assert.Len(t, teardowns, 2) {
+		assert.Equal(t, `fixture "store" teardown`, teardowns[0].Name)
+		assert.Equal(t, `fixture "server" teardown`, teardowns[1].Name)
+		assert.Contains(t, teardowns[1].run().Message, "server is busy")
+	}
+	assert.Empty(t, fs.teardowns())
+}
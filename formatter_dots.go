@@ -17,6 +17,7 @@ const (
 	undefinedColor = color.FgYellow
 	pendingColor   = color.FgYellow
 	ambiguousColor = color.FgMagenta
+	flakyColor     = color.FgHiYellow
 )
 
 type dotFormatter struct {
@@ -1,6 +1,7 @@
 package cucumber
 
 import (
+	"encoding/base64"
 	"fmt"
 	"io"
 	"strings"
@@ -11,6 +12,7 @@ import (
 )
 
 type stepDescription struct {
+	PickleId         string
 	ScenarioName     string
 	ScenarioLocation string
 	StepName         string
@@ -18,19 +20,43 @@ type stepDescription struct {
 	Error            string
 }
 
+// Snippet with undefined steps it implements
+type stepSnippet struct {
+	Snippet string
+	Steps   []string
+}
+
+type flakyScenario struct {
+	ScenarioName     string
+	ScenarioLocation string
+	Attempts         int
+}
+
 type summaryFormatter struct {
 	out         io.Writer
 	failedSteps []stepDescription
+	skipped     []stepDescription
+	flaky       []flakyScenario
+	failedHooks []string
+	snippets    []*stepSnippet
 	pickleMap   map[string]*messages.Pickle
+	running     map[string]bool
+	attachments map[string][]*messages.Attachment
+	attempts    map[string]int
+	lastAttempt map[string]string
+	results     map[string]messages.TestResult_Status
 	start       time.Time
 	duration    time.Duration
 
 	Success            bool
+	Interrupted        bool
 	TestCasesTotal     int
 	TestCasesPassed    int
+	TestCasesFlaky     int
 	TestCasesFailed    int
 	TestCasesPending   int
 	TestCasesUndefined int
+	TestCasesSkipped   int
 	StepsTotal         int
 	StepsPassed        int
 	StepsFailed        int
@@ -41,33 +67,109 @@ type summaryFormatter struct {
 
 func NewSummaryFormatter(stdout io.Writer) *summaryFormatter {
 	return &summaryFormatter{
-		out:       stdout,
-		pickleMap: map[string]*messages.Pickle{},
+		out:         stdout,
+		pickleMap:   map[string]*messages.Pickle{},
+		running:     map[string]bool{},
+		attachments: map[string][]*messages.Attachment{},
+		attempts:    map[string]int{},
+		lastAttempt: map[string]string{},
+		results:     map[string]messages.TestResult_Status{},
 	}
 }
 
 func (sf *summaryFormatter) ProcessMessage(msg *messages.Envelope) {
 	switch m := msg.Message.(type) {
 	case *messages.Envelope_TestRunStarted:
+		// The same formatter may report several runs of a suite
+		*sf = *NewSummaryFormatter(sf.out)
 		sf.start = time.Now()
 	case *messages.Envelope_TestRunFinished:
 		sf.duration = time.Since(sf.start)
 		sf.Success = m.TestRunFinished.Success
 		sf.displaySummary()
+	case *messages.Envelope_CommandError:
+		if m.CommandError == ErrInterrupted.Error() {
+			sf.Interrupted = true
+			break
+		}
+
+		color.New(failureColor).Fprintf(sf.out, "\nError: %s\n", m.CommandError)
 	case *messages.Envelope_CommandInitializeTestCase:
-		sf.TestCasesTotal += 1
+		pickle := m.CommandInitializeTestCase.Pickle
+		location := scenarioLocation(pickle)
 
-		sf.pickleMap[m.CommandInitializeTestCase.Pickle.Id] = m.CommandInitializeTestCase.Pickle
+		// Retried scenarios are initialized again with new pickle ids
+		if sf.attempts[location] == 0 {
+			sf.TestCasesTotal += 1
+		}
+
+		sf.attempts[location] += 1
+		sf.lastAttempt[location] = pickle.Id
+		sf.pickleMap[pickle.Id] = pickle
+	case *messages.Envelope_TestCaseStarted:
+		sf.running[m.TestCaseStarted.PickleId] = true
+	case *messages.Envelope_Attachment:
+		if pickleId, ok := sf.attachmentPickle(m.Attachment); ok {
+			sf.attachments[pickleId] = append(sf.attachments[pickleId], m.Attachment)
+		}
 	case *messages.Envelope_TestCaseFinished:
-		switch m.TestCaseFinished.TestResult.Status {
-		case messages.TestResult_PASSED:
-			sf.TestCasesPassed += 1
-		case messages.TestResult_FAILED:
-			sf.TestCasesFailed += 1
-		case messages.TestResult_PENDING:
-			sf.TestCasesPending += 1
-		case messages.TestResult_UNDEFINED:
-			sf.TestCasesUndefined += 1
+		delete(sf.running, m.TestCaseFinished.PickleId)
+
+		status := m.TestCaseFinished.TestResult.Status
+
+		pickle, ok := sf.pickleMap[m.TestCaseFinished.PickleId]
+		if !ok {
+			sf.countTestCase(status, 1)
+			break
+		}
+
+		location := scenarioLocation(pickle)
+
+		// Only the last attempt of a retried scenario is counted,
+		// it is flaky when it passes after a failed attempt
+		if previous, retried := sf.results[location]; retried {
+			sf.countTestCase(previous, -1)
+
+			if status == messages.TestResult_PASSED && causesFailure(&messages.TestResult{Status: previous}, true) {
+				sf.TestCasesFlaky += 1
+				sf.flaky = append(sf.flaky, flakyScenario{
+					ScenarioName:     pickle.Name,
+					ScenarioLocation: location,
+					Attempts:         sf.attempts[location],
+				})
+
+				sf.results[location] = status
+				break
+			}
+		}
+
+		sf.countTestCase(status, 1)
+		sf.results[location] = status
+	case *messages.Envelope_TestHookFinished:
+		if m.TestHookFinished.TestResult.Status == messages.TestResult_SKIPPED && m.TestHookFinished.TestResult.Message != "" && m.TestHookFinished.PickleId != "" {
+			pickle := sf.pickleMap[m.TestHookFinished.PickleId]
+			pickleLocation := pickle.Locations[len(pickle.Locations)-1].Line
+
+			sf.skipped = append(sf.skipped, stepDescription{
+				PickleId:         pickle.Id,
+				ScenarioName:     pickle.Name,
+				ScenarioLocation: fmt.Sprintf("%s:%d", pickle.Uri, pickleLocation),
+				StepName:         "Hook",
+				Error:            m.TestHookFinished.TestResult.Message,
+			})
+		} else if m.TestHookFinished.TestResult.Status == messages.TestResult_FAILED && m.TestHookFinished.PickleId == "" {
+			sf.failedHooks = append(sf.failedHooks, m.TestHookFinished.TestResult.Message)
+		} else if m.TestHookFinished.TestResult.Status == messages.TestResult_FAILED {
+			pickle := sf.pickleMap[m.TestHookFinished.PickleId]
+			pickleLocation := pickle.Locations[len(pickle.Locations)-1].Line
+
+			sf.failedSteps = append(sf.failedSteps, stepDescription{
+				PickleId:         pickle.Id,
+				ScenarioName:     pickle.Name,
+				ScenarioLocation: fmt.Sprintf("%s:%d", pickle.Uri, pickleLocation),
+				StepName:         "Hook",
+				Error:            m.TestHookFinished.TestResult.Message,
+			})
 		}
 	case *messages.Envelope_TestStepFinished:
 		sf.StepsTotal += 1
@@ -85,6 +187,7 @@ func (sf *summaryFormatter) ProcessMessage(msg *messages.Envelope) {
 			stepLocation := step.Locations[len(step.Locations)-1].Line
 
 			sf.failedSteps = append(sf.failedSteps, stepDescription{
+				PickleId:         pickle.Id,
 				ScenarioName:     pickle.Name,
 				ScenarioLocation: fmt.Sprintf("%s:%d", pickle.Uri, pickleLocation),
 				StepName:         step.Text,
@@ -95,41 +198,232 @@ func (sf *summaryFormatter) ProcessMessage(msg *messages.Envelope) {
 			sf.StepsPending += 1
 		case messages.TestResult_UNDEFINED:
 			sf.StepsUndefined += 1
+
+			pickle := sf.pickleMap[m.TestStepFinished.PickleId]
+			step := pickle.Steps[m.TestStepFinished.Index]
+			stepLocation := step.Locations[len(step.Locations)-1].Line
+
+			sf.addSnippet(m.TestStepFinished.TestResult.Message, fmt.Sprintf("%s:%d %s", pickle.Uri, stepLocation, step.Text))
 		case messages.TestResult_SKIPPED:
 			sf.StepsSkipped += 1
+
+			// Steps skipped after a failure have no reason
+			if m.TestStepFinished.TestResult.Message == "" {
+				break
+			}
+
+			pickle := sf.pickleMap[m.TestStepFinished.PickleId]
+			pickleLocation := pickle.Locations[len(pickle.Locations)-1].Line
+
+			step := pickle.Steps[m.TestStepFinished.Index]
+			stepLocation := step.Locations[len(step.Locations)-1].Line
+
+			sf.skipped = append(sf.skipped, stepDescription{
+				PickleId:         pickle.Id,
+				ScenarioName:     pickle.Name,
+				ScenarioLocation: fmt.Sprintf("%s:%d", pickle.Uri, pickleLocation),
+				StepName:         step.Text,
+				StepLocation:     fmt.Sprintf("%s:%d", pickle.Uri, stepLocation),
+				Error:            m.TestStepFinished.TestResult.Message,
+			})
 		}
 	}
 }
 
 func (sf *summaryFormatter) displaySummary() {
-	if len(sf.failedSteps) > 0 {
+	if len(sf.failedHooks) > 0 {
+		color.New(failureColor).Fprint(sf.out, "\n\nFailed hooks:\n")
+		for _, message := range sf.failedHooks {
+			color.New(color.FgHiRed).Fprintf(sf.out, "\n  %s\n", message)
+		}
+	}
+
+	var failedSteps []stepDescription
+	for _, fs := range sf.failedSteps {
+		if !sf.superseded(fs.PickleId) {
+			failedSteps = append(failedSteps, fs)
+		}
+	}
+
+	if len(failedSteps) > 0 {
+		displayedAttachments := map[string]bool{}
+
 		color.New(failureColor).Fprint(sf.out, "\n\nFailed steps:\n")
-		for _, fs := range sf.failedSteps {
+		for _, fs := range failedSteps {
 			color.New(failureColor).Fprintf(sf.out, "\n  Scenario: %s", fs.ScenarioName)
 			color.New(color.FgBlack).Fprintf(sf.out, " # %s\n", fs.ScenarioLocation)
 			color.New(failureColor).Fprintf(sf.out, "    %s", fs.StepName)
-			color.New(color.FgBlack).Fprintf(sf.out, " # %s\n", fs.StepLocation)
+			if fs.StepLocation != "" {
+				color.New(color.FgBlack).Fprintf(sf.out, " # %s", fs.StepLocation)
+			}
+			fmt.Fprint(sf.out, "\n")
 			color.New(failureColor).Fprint(sf.out, "      Error: ")
-			color.New(color.FgHiRed).Fprintf(sf.out, "%s\n", fs.Error)
+			color.New(color.FgHiRed).Fprintf(sf.out, "%s\n", strings.Replace(fs.Error, "\n", "\n             ", -1))
+
+			if !displayedAttachments[fs.PickleId] {
+				displayedAttachments[fs.PickleId] = true
+				sf.displayAttachments(sf.attachments[fs.PickleId])
+			}
+		}
+	}
+
+	if len(sf.flaky) > 0 {
+		color.New(flakyColor).Fprint(sf.out, "\n\nFlaky scenarios:\n")
+		for _, fs := range sf.flaky {
+			color.New(flakyColor).Fprintf(sf.out, "\n  Scenario: %s", fs.ScenarioName)
+			color.New(color.FgBlack).Fprintf(sf.out, " # %s\n", fs.ScenarioLocation)
+			color.New(flakyColor).Fprintf(sf.out, "      Passed after %d attempts\n", fs.Attempts)
+		}
+	}
+
+	if len(sf.skipped) > 0 {
+		color.New(skippedColor).Fprint(sf.out, "\n\nSkipped scenarios:\n")
+		for _, ss := range sf.skipped {
+			color.New(skippedColor).Fprintf(sf.out, "\n  Scenario: %s", ss.ScenarioName)
+			color.New(color.FgBlack).Fprintf(sf.out, " # %s\n", ss.ScenarioLocation)
+			color.New(skippedColor).Fprintf(sf.out, "    %s", ss.StepName)
+			if ss.StepLocation != "" {
+				color.New(color.FgBlack).Fprintf(sf.out, " # %s", ss.StepLocation)
+			}
+			fmt.Fprint(sf.out, "\n")
+			color.New(skippedColor).Fprintf(sf.out, "      Reason: %s\n", ss.Error)
+		}
+	}
+
+	if len(sf.snippets) > 0 {
+		color.New(undefinedColor).Fprint(sf.out, "\n\nYou can implement missing steps with the snippets below:\n")
+		for _, snippet := range sf.snippets {
+			fmt.Fprint(sf.out, "\n")
+			for _, step := range snippet.Steps {
+				color.New(color.FgBlack).Fprintf(sf.out, "// %s\n", step)
+			}
+			color.New(undefinedColor).Fprintf(sf.out, "%s\n", snippet.Snippet)
 		}
 	}
 
+	if sf.Interrupted {
+		color.New(failureColor).Fprint(sf.out, "\n\nInterrupted, remaining scenarios were skipped\n")
+	}
+
 	fmt.Fprint(sf.out, "\n")
-	scenarioStatusSummary := statusSummary(sf.TestCasesPassed, sf.TestCasesFailed, sf.TestCasesPending, sf.TestCasesUndefined, 0)
+	scenarioStatusSummary := statusSummary(sf.TestCasesPassed, sf.TestCasesFlaky, sf.TestCasesFailed, sf.TestCasesPending, sf.TestCasesUndefined, sf.TestCasesSkipped)
 	fmt.Fprintf(sf.out, "%d scenarios (%s)\n", sf.TestCasesTotal, scenarioStatusSummary)
 
-	stepStatusSummary := statusSummary(sf.StepsPassed, sf.StepsFailed, sf.StepsPending, sf.StepsUndefined, sf.StepsSkipped)
+	stepStatusSummary := statusSummary(sf.StepsPassed, 0, sf.StepsFailed, sf.StepsPending, sf.StepsUndefined, sf.StepsSkipped)
 	fmt.Fprintf(sf.out, "%d steps (%s)\n", sf.StepsTotal, stepStatusSummary)
 	fmt.Fprintln(sf.out, sf.duration)
 }
 
-func statusSummary(passed, failed, pending, undefined, skipped int) string {
+// Text attachments are displayed as logs, other attachments only by their type and size
+func (sf *summaryFormatter) displayAttachments(attachments []*messages.Attachment) {
+	for _, attachment := range attachments {
+		if attachment.Media.Encoding == messages.Media_UTF8 && attachment.Media.ContentType == "text/plain" {
+			fmt.Fprintf(sf.out, "      Log: %s\n", attachment.Data)
+			continue
+		}
+
+		size := len(attachment.Data)
+		if attachment.Media.Encoding == messages.Media_BASE64 {
+			data, _ := base64.StdEncoding.DecodeString(attachment.Data)
+			size = len(data)
+		}
+
+		fmt.Fprintf(sf.out, "      Attachment: %s (%d bytes)\n", attachment.Media.ContentType, size)
+	}
+}
+
+// Attachments are located at the step or scenario of a running test case
+func (sf *summaryFormatter) attachmentPickle(attachment *messages.Attachment) (string, bool) {
+	if attachment.Source == nil || attachment.Source.Location == nil {
+		return "", false
+	}
+
+	line := attachment.Source.Location.Line
+
+	for pickleId := range sf.running {
+		pickle := sf.pickleMap[pickleId]
+		if pickle == nil || pickle.Uri != attachment.Source.Uri {
+			continue
+		}
+
+		if pickle.Locations[len(pickle.Locations)-1].Line == line {
+			return pickleId, true
+		}
+
+		for _, step := range pickle.Steps {
+			if step.Locations[len(step.Locations)-1].Line == line {
+				return pickleId, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (sf *summaryFormatter) countTestCase(status messages.TestResult_Status, n int) {
+	switch status {
+	case messages.TestResult_PASSED:
+		sf.TestCasesPassed += n
+	case messages.TestResult_FAILED:
+		sf.TestCasesFailed += n
+	case messages.TestResult_PENDING:
+		sf.TestCasesPending += n
+	case messages.TestResult_UNDEFINED:
+		sf.TestCasesUndefined += n
+	case messages.TestResult_SKIPPED:
+		sf.TestCasesSkipped += n
+	}
+}
+
+// Failures of earlier attempts are not displayed once the scenario was retried
+func (sf *summaryFormatter) superseded(pickleId string) bool {
+	pickle, ok := sf.pickleMap[pickleId]
+	if !ok {
+		return false
+	}
+
+	return sf.lastAttempt[scenarioLocation(pickle)] != pickleId
+}
+
+func scenarioLocation(pickle *messages.Pickle) string {
+	return fmt.Sprintf("%s:%d", pickle.Uri, pickle.Locations[len(pickle.Locations)-1].Line)
+}
+
+// Groups undefined steps by their snippet, retried steps are listed once
+func (sf *summaryFormatter) addSnippet(snippet, step string) {
+	if snippet == "" {
+		return
+	}
+
+	for _, s := range sf.snippets {
+		if s.Snippet != snippet {
+			continue
+		}
+
+		for _, existing := range s.Steps {
+			if existing == step {
+				return
+			}
+		}
+
+		s.Steps = append(s.Steps, step)
+		return
+	}
+
+	sf.snippets = append(sf.snippets, &stepSnippet{Snippet: snippet, Steps: []string{step}})
+}
+
+func statusSummary(passed, flaky, failed, pending, undefined, skipped int) string {
 	var acc []string
 
 	if passed > 0 {
 		acc = append(acc, color.New(successColor).Sprintf("%d passed", passed))
 	}
 
+	if flaky > 0 {
+		acc = append(acc, color.New(flakyColor).Sprintf("%d flaky", flaky))
+	}
+
 	if failed > 0 {
 		acc = append(acc, color.New(failureColor).Sprintf("%d failed", failed))
 	}
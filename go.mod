@@ -4,7 +4,9 @@ go 1.12
 
 require (
 	github.com/cucumber/cucumber-engine v0.0.8
+	github.com/cucumber/cucumber-expressions-go v0.0.0-20190520094527-6bf122a7df69
 	github.com/cucumber/cucumber-messages-go/v3 v3.0.0
+	github.com/cucumber/tag-expressions-go v0.0.0-20181031233154-abafd42c3c9f
 	github.com/fatih/color v1.7.0
 	github.com/mattn/go-colorable v0.1.2 // indirect
 	github.com/stretchr/testify v1.3.0
@@ -0,0 +1,152 @@
+package cucumber
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	tagexpressions "github.com/cucumber/tag-expressions-go"
+)
+
+type beforeHookFunc func(TestCase) error
+
+type afterHookFunc func(TestCase, ScenarioResult) error
+
+type testRunHookFunc func() error
+
+type beforeStepHookFunc func(TestCase, Step) error
+
+type afterStepHookFunc func(TestCase, Step, StepResult) error
+
+// Cleanups registered with TestCase are run by an after hook
+// defined last, so they run after all other after hooks
+var cleanupHookConfig = &messages.TestCaseHookDefinitionConfig{
+	Id: "cleanup",
+}
+
+type hookDefinition struct {
+	TagExpression string
+	Handler       afterHookFunc
+	Location      *messages.SourceReference
+
+	tags tagexpressions.Evaluatable
+}
+
+func newHookDefinition(tagExpression string, fn afterHookFunc) hookDefinition {
+	tags, err := tagexpressions.Parse(tagExpression)
+	if err != nil {
+		panic(fmt.Sprintf("invalid hook tag expression %q: %s", tagExpression, err))
+	}
+
+	hd := hookDefinition{
+		TagExpression: tagExpression,
+		Handler:       fn,
+		tags:          tags,
+	}
+
+	// Skip newHookDefinition and suite method defining the hook
+	hd.Location = callerLocation(2)
+
+	return hd
+}
+
+type testRunHookDefinition struct {
+	Name     string
+	Handler  testRunHookFunc
+	Location *messages.SourceReference
+}
+
+func newTestRunHookDefinition(name string, fn testRunHookFunc) testRunHookDefinition {
+	return testRunHookDefinition{
+		Name:     name,
+		Handler:  fn,
+		Location: callerLocation(2),
+	}
+}
+
+// Runs test run hook, failure message is prefixed with hook location
+func (hd testRunHookDefinition) run() *messages.TestResult {
+	testResult := execute(hd.Name, hd.Handler)
+
+	if testResult.Status == messages.TestResult_FAILED && hd.Location != nil {
+		testResult.Message = fmt.Sprintf("%s:%d: %s", hd.Location.Uri, hd.Location.Location.Line, testResult.Message)
+	}
+
+	return testResult
+}
+
+func callerLocation(skip int) *messages.SourceReference {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return nil
+	}
+
+	return &messages.SourceReference{
+		Uri:      file,
+		Location: &messages.Location{Line: uint32(line)},
+	}
+}
+
+func (hd hookDefinition) matches(pickle *messages.Pickle) bool {
+	return matchesTags(hd.tags, pickle)
+}
+
+type stepHookDefinition struct {
+	TagExpression string
+	Handler       afterStepHookFunc
+
+	tags tagexpressions.Evaluatable
+}
+
+func newStepHookDefinition(tagExpression string, fn afterStepHookFunc) stepHookDefinition {
+	tags, err := tagexpressions.Parse(tagExpression)
+	if err != nil {
+		panic(fmt.Sprintf("invalid hook tag expression %q: %s", tagExpression, err))
+	}
+
+	return stepHookDefinition{
+		TagExpression: tagExpression,
+		Handler:       fn,
+		tags:          tags,
+	}
+}
+
+func (hd stepHookDefinition) matches(pickle *messages.Pickle) bool {
+	return matchesTags(hd.tags, pickle)
+}
+
+func matchesTags(tags tagexpressions.Evaluatable, pickle *messages.Pickle) bool {
+	var names []string
+	for _, tag := range pickle.Tags {
+		names = append(names, tag.Name)
+	}
+
+	return tags.Evaluate(names)
+}
+
+func hookConfigs(hooks []hookDefinition) []*messages.TestCaseHookDefinitionConfig {
+	var configs []*messages.TestCaseHookDefinitionConfig
+
+	for i, hd := range hooks {
+		configs = append(configs, &messages.TestCaseHookDefinitionConfig{
+			Id:            strconv.Itoa(i),
+			TagExpression: hd.TagExpression,
+			Location:      hd.Location,
+		})
+	}
+
+	return configs
+}
+
+func matchingHooks(hooks []hookDefinition, pickle *messages.Pickle) int {
+	count := 0
+
+	for _, hd := range hooks {
+		if hd.matches(pickle) {
+			count++
+		}
+	}
+
+	return count
+}
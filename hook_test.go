@@ -0,0 +1,29 @@
+package cucumber
+
+import (
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchingHooks(t *testing.T) {
+	noop := func(TestCase, ScenarioResult) error { return nil }
+	hooks := []hookDefinition{
+		newHookDefinition("", noop),
+		newHookDefinition("@db", noop),
+		newHookDefinition("@db and not @slow", noop),
+	}
+
+	pickle := &messages.Pickle{Tags: []*messages.Pickle_PickleTag{{Name: "@db"}}}
+	assert.Equal(t, 3, matchingHooks(hooks, pickle))
+
+	pickle.Tags = append(pickle.Tags, &messages.Pickle_PickleTag{Name: "@slow"})
+	assert.Equal(t, 2, matchingHooks(hooks, pickle))
+
+	assert.Equal(t, 1, matchingHooks(hooks, &messages.Pickle{}))
+
+	assert.Panics(t, func() {
+		newHookDefinition("@db and", noop)
+	})
+}
@@ -0,0 +1,74 @@
+package cucumber
+
+import (
+	"sort"
+	"sync"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Scenarios tagged @serial run alone, scenarios tagged @exclusive(name)
+// never run together with other scenarios holding the same name.
+// Locks are always taken in the same order, so scenarios holding them
+// never wait for each other.
+type scenarioLocks struct {
+	serial sync.RWMutex
+	named  map[string]*sync.Mutex
+	mu     sync.Mutex
+}
+
+// Blocks until scenario can run, returns function releasing its locks
+func (l *scenarioLocks) lock(pickle *messages.Pickle) func() {
+	var unlocks []func()
+
+	if hasTag(pickle, "@serial") {
+		l.serial.Lock()
+		unlocks = append(unlocks, l.serial.Unlock)
+	} else {
+		l.serial.RLock()
+		unlocks = append(unlocks, l.serial.RUnlock)
+	}
+
+	for _, name := range exclusiveNames(pickle) {
+		mu := l.namedLock(name)
+		mu.Lock()
+		unlocks = append(unlocks, mu.Unlock)
+	}
+
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+func (l *scenarioLocks) namedLock(name string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.named == nil {
+		l.named = map[string]*sync.Mutex{}
+	}
+
+	if _, ok := l.named[name]; !ok {
+		l.named[name] = &sync.Mutex{}
+	}
+
+	return l.named[name]
+}
+
+func exclusiveNames(pickle *messages.Pickle) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, name := range tagArguments(pickle, "exclusive") {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,39 @@
+package cucumber
+
+import (
+	"fmt"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+type parameterTransformerFunc func(...string) (interface{}, error)
+
+type parameterType struct {
+	Name        string
+	Regexps     []string
+	Transformer parameterTransformerFunc
+}
+
+func (pt parameterType) config() *messages.ParameterTypeConfig {
+	return &messages.ParameterTypeConfig{
+		Name:               pt.Name,
+		RegularExpressions: pt.Regexps,
+		UseForSnippets:     true,
+	}
+}
+
+func (pt parameterType) transform(captures []string) (interface{}, error) {
+	if pt.Transformer == nil {
+		if len(captures) == 0 {
+			return "", nil
+		}
+		return captures[0], nil
+	}
+
+	value, err := pt.Transformer(captures...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform {%s} parameter %q: %s", pt.Name, captures, err)
+	}
+
+	return value, nil
+}
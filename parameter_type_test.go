@@ -0,0 +1,35 @@
+package cucumber
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParameterTypeTransform(t *testing.T) {
+	pt := parameterType{Name: "color", Regexps: []string{"red|blue"}}
+	value, err := pt.transform([]string{"red"})
+	assert.NoError(t, err)
+	assert.Equal(t, "red", value)
+
+	pt = parameterType{
+		Name:    "number",
+		Regexps: []string{`\d+`},
+		Transformer: func(captures ...string) (interface{}, error) {
+			return strconv.Atoi(captures[0])
+		},
+	}
+	value, err = pt.transform([]string{"42"})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, value)
+
+	pt.Transformer = func(captures ...string) (interface{}, error) {
+		return nil, errors.New("boom")
+	}
+	_, err = pt.transform([]string{"42"})
+	if assert.Error(t, err) {
+		assert.Equal(t, `failed to transform {number} parameter ["42"]: boom`, err.Error())
+	}
+}
@@ -0,0 +1,202 @@
+package cucumber
+
+import (
+	"time"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+type Status uint8
+
+const (
+	// Status of scenarios that did not finish
+	StatusUnknown Status = iota
+	StatusPassed
+	StatusFailed
+	StatusPending
+	StatusUndefined
+	StatusSkipped
+	StatusAmbiguous
+)
+
+var statusNames = map[Status]string{
+	StatusUnknown:   "unknown",
+	StatusPassed:    "passed",
+	StatusFailed:    "failed",
+	StatusPending:   "pending",
+	StatusUndefined: "undefined",
+	StatusSkipped:   "skipped",
+	StatusAmbiguous: "ambiguous",
+}
+
+func (s Status) String() string {
+	return statusNames[s]
+}
+
+func newStatus(status messages.TestResult_Status) Status {
+	switch status {
+	case messages.TestResult_PASSED:
+		return StatusPassed
+	case messages.TestResult_FAILED:
+		return StatusFailed
+	case messages.TestResult_PENDING:
+		return StatusPending
+	case messages.TestResult_UNDEFINED:
+		return StatusUndefined
+	case messages.TestResult_SKIPPED:
+		return StatusSkipped
+	case messages.TestResult_AMBIGUOUS:
+		return StatusAmbiguous
+	}
+
+	return StatusUnknown
+}
+
+// Result of the scenario so far, passed to after hooks
+type ScenarioResult struct {
+	Status   Status
+	Message  string
+	Duration time.Duration
+}
+
+func newScenarioResult(result *messages.TestResult) ScenarioResult {
+	return ScenarioResult{
+		Status:   newStatus(result.Status),
+		Message:  result.Message,
+		Duration: time.Duration(result.DurationNanoseconds),
+	}
+}
+
+// Result of the step, passed to after step hooks
+type StepResult struct {
+	Status   Status
+	Message  string
+	Duration time.Duration
+}
+
+func newStepResult(result *messages.TestResult) StepResult {
+	return StepResult{
+		Status:   newStatus(result.Status),
+		Message:  result.Message,
+		Duration: time.Duration(result.DurationNanoseconds),
+	}
+}
+
+// Combines step and hook results into test case result the same way cucumber-engine does
+func updateResult(result *messages.TestResult, stepResult *messages.TestResult) {
+	result.DurationNanoseconds += stepResult.DurationNanoseconds
+
+	switch stepResult.Status {
+	case messages.TestResult_FAILED, messages.TestResult_AMBIGUOUS:
+		if result.Status != messages.TestResult_FAILED && result.Status != messages.TestResult_AMBIGUOUS {
+			result.Status = stepResult.Status
+		}
+	default:
+		if result.Status == messages.TestResult_PASSED || result.Status == messages.TestResult_SKIPPED {
+			result.Status = stepResult.Status
+		}
+	}
+
+	if stepResult.Message != "" && result.Message == "" {
+		result.Message = stepResult.Message
+	}
+}
+
+// Reports whether result fails the test run the same way cucumber-engine does
+func causesFailure(result *messages.TestResult, strict bool) bool {
+	switch result.Status {
+	case messages.TestResult_FAILED, messages.TestResult_AMBIGUOUS, messages.TestResult_UNDEFINED:
+		return true
+	case messages.TestResult_PENDING:
+		return strict
+	}
+
+	return false
+}
+
+// Result of the test run returned by RunContext
+type Result struct {
+	Success     bool
+	Interrupted bool
+
+	// Seed used to order scenarios
+	Seed uint64
+
+	// Configuration after applying arguments and defaults
+	Config Config
+
+	Duration time.Duration
+
+	// Scenarios in order they started, retried scenarios
+	// are reported once with their last attempt
+	Scenarios []ScenarioReport
+
+	// Totals of scenarios and their steps
+	ScenarioTotals Totals
+	StepTotals     Totals
+
+	// Failures of before all and after all hooks and cucumber-engine errors
+	Errors []string
+}
+
+// Number of scenarios or steps by status, scenarios that
+// did not finish are counted only in Total
+type Totals struct {
+	Total     int
+	Passed    int
+	Flaky     int
+	Failed    int
+	Pending   int
+	Undefined int
+	Skipped   int
+	Ambiguous int
+}
+
+func (t *Totals) add(status Status, flaky bool) {
+	t.Total++
+
+	switch {
+	case flaky:
+		t.Flaky++
+	case status == StatusPassed:
+		t.Passed++
+	case status == StatusFailed:
+		t.Failed++
+	case status == StatusPending:
+		t.Pending++
+	case status == StatusUndefined:
+		t.Undefined++
+	case status == StatusSkipped:
+		t.Skipped++
+	case status == StatusAmbiguous:
+		t.Ambiguous++
+	}
+}
+
+// Scenario of the test run, for scenario outlines Line is the example row
+type ScenarioReport struct {
+	Name     string
+	Feature  string
+	URI      string
+	Line     int
+	Tags     []string
+	Status   Status
+	Message  string
+	Duration time.Duration
+
+	// Number of times the scenario was run, scenarios passing
+	// after a retry are flaky
+	Attempts int
+	Flaky    bool
+
+	Steps []StepReport
+}
+
+type StepReport struct {
+	Text     string
+	URI      string
+	Line     int
+	Status   Status
+	Message  string
+	Duration time.Duration
+}
@@ -0,0 +1,136 @@
+package cucumber
+
+import (
+	"fmt"
+	"time"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Builds Result from messages sent to formatters
+type resultCollector struct {
+	result    Result
+	start     time.Time
+	pickles   map[string]*messages.Pickle
+	features  map[string]string
+	locations map[string]int
+	running   map[string]int
+}
+
+func newResultCollector() *resultCollector {
+	return &resultCollector{
+		pickles:   map[string]*messages.Pickle{},
+		features:  map[string]string{},
+		locations: map[string]int{},
+		running:   map[string]int{},
+	}
+}
+
+func (rc *resultCollector) ProcessMessage(msg *messages.Envelope) {
+	switch m := msg.Message.(type) {
+	case *messages.Envelope_TestRunStarted:
+		rc.start = time.Now()
+	case *messages.Envelope_TestRunFinished:
+		rc.result.Success = m.TestRunFinished.Success
+		rc.result.Duration = time.Since(rc.start)
+	case *messages.Envelope_CommandError:
+		if m.CommandError != ErrInterrupted.Error() {
+			rc.result.Errors = append(rc.result.Errors, m.CommandError)
+		}
+	case *messages.Envelope_GherkinDocument:
+		if m.GherkinDocument.Feature != nil {
+			rc.features[m.GherkinDocument.Uri] = m.GherkinDocument.Feature.Name
+		}
+	case *messages.Envelope_Pickle:
+		rc.pickles[m.Pickle.Id] = m.Pickle
+	case *messages.Envelope_TestCaseStarted:
+		pickle, ok := rc.pickles[m.TestCaseStarted.PickleId]
+		if !ok {
+			break
+		}
+
+		line := int(pickle.Locations[len(pickle.Locations)-1].Line)
+		location := fmt.Sprintf("%s:%d", pickle.Uri, line)
+
+		// Retried scenario replaces its previous attempt
+		if i, ok := rc.locations[location]; ok {
+			scenario := &rc.result.Scenarios[i]
+			scenario.Attempts++
+			scenario.Status = StatusUnknown
+			scenario.Message = ""
+			scenario.Duration = 0
+			scenario.Flaky = false
+			scenario.Steps = nil
+			rc.running[pickle.Id] = i
+			break
+		}
+
+		var tags []string
+		for _, tag := range pickle.Tags {
+			tags = append(tags, tag.Name)
+		}
+
+		rc.result.Scenarios = append(rc.result.Scenarios, ScenarioReport{
+			Name:     pickle.Name,
+			Feature:  rc.features[pickle.Uri],
+			URI:      pickle.Uri,
+			Line:     line,
+			Tags:     tags,
+			Attempts: 1,
+		})
+
+		rc.locations[location] = len(rc.result.Scenarios) - 1
+		rc.running[pickle.Id] = len(rc.result.Scenarios) - 1
+	case *messages.Envelope_TestStepFinished:
+		i, ok := rc.running[m.TestStepFinished.PickleId]
+		if !ok {
+			break
+		}
+
+		pickle := rc.pickles[m.TestStepFinished.PickleId]
+		step := pickle.Steps[m.TestStepFinished.Index]
+		result := m.TestStepFinished.TestResult
+
+		rc.result.Scenarios[i].Steps = append(rc.result.Scenarios[i].Steps, StepReport{
+			Text:     step.Text,
+			URI:      pickle.Uri,
+			Line:     int(step.Locations[len(step.Locations)-1].Line),
+			Status:   newStatus(result.Status),
+			Message:  result.Message,
+			Duration: time.Duration(result.DurationNanoseconds),
+		})
+	case *messages.Envelope_TestHookFinished:
+		if m.TestHookFinished.PickleId == "" && m.TestHookFinished.TestResult.Status == messages.TestResult_FAILED {
+			rc.result.Errors = append(rc.result.Errors, m.TestHookFinished.TestResult.Message)
+		}
+	case *messages.Envelope_TestCaseFinished:
+		i, ok := rc.running[m.TestCaseFinished.PickleId]
+		if !ok {
+			break
+		}
+		delete(rc.running, m.TestCaseFinished.PickleId)
+
+		scenario := &rc.result.Scenarios[i]
+		result := m.TestCaseFinished.TestResult
+
+		scenario.Status = newStatus(result.Status)
+		scenario.Message = result.Message
+		scenario.Duration = time.Duration(result.DurationNanoseconds)
+		scenario.Flaky = scenario.Attempts > 1 && scenario.Status == StatusPassed
+	}
+}
+
+// Returns collected result with totals
+func (rc *resultCollector) finish() *Result {
+	result := rc.result
+
+	for _, scenario := range result.Scenarios {
+		result.ScenarioTotals.add(scenario.Status, scenario.Flaky)
+
+		for _, step := range scenario.Steps {
+			result.StepTotals.add(step.Status, false)
+		}
+	}
+
+	return &result
+}
@@ -0,0 +1,101 @@
+package cucumber
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Attempts of scenarios keyed by their location, cucumber-engine assigns
+// new pickle ids on every run, so retried scenarios are matched by uri and line
+type scenarioAttempts struct {
+	scenarios map[string]*scenarioAttempt
+}
+
+type scenarioAttempt struct {
+	uri     string
+	line    uint64
+	retries uint64
+	retried uint64
+	status  *messages.TestResult
+	flaky   bool
+}
+
+// Records result of scenario attempt, reports whether scenario will be retried
+func (a *scenarioAttempts) record(pickle *messages.Pickle, result *messages.TestResult, retries uint64, strict bool) bool {
+	if a.scenarios == nil {
+		a.scenarios = map[string]*scenarioAttempt{}
+	}
+
+	line := uint64(pickle.Locations[len(pickle.Locations)-1].Line)
+	key := fmt.Sprintf("%s:%d", pickle.Uri, line)
+
+	attempt, ok := a.scenarios[key]
+	if !ok {
+		attempt = &scenarioAttempt{
+			uri:     pickle.Uri,
+			line:    line,
+			retries: retries,
+		}
+		a.scenarios[key] = attempt
+	} else if causesFailure(attempt.status, strict) && !causesFailure(result, strict) {
+		attempt.flaky = true
+	}
+
+	attempt.status = result
+
+	return attempt.retry()
+}
+
+// Only failed scenarios are retried, undefined, ambiguous
+// and pending steps give the same result on every attempt
+func (a *scenarioAttempt) retry() bool {
+	return a.status.Status == messages.TestResult_FAILED && a.retried < a.retries
+}
+
+// Returns lines of failed scenarios to retry by uri and counts them as retried
+func (a *scenarioAttempts) due() map[string][]uint64 {
+	lines := map[string][]uint64{}
+
+	for _, attempt := range a.scenarios {
+		if attempt.retry() {
+			attempt.retried++
+			lines[attempt.uri] = append(lines[attempt.uri], attempt.line)
+		}
+	}
+
+	for _, l := range lines {
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	}
+
+	return lines
+}
+
+// Reports whether last attempts of all scenarios succeeded,
+// flaky scenarios fail the run only with strictFlaky
+func (a *scenarioAttempts) success(strict, strictFlaky bool) bool {
+	for _, attempt := range a.scenarios {
+		if causesFailure(attempt.status, strict) || (strictFlaky && attempt.flaky) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns number of retries of the scenario, @retry(n) tag takes precedence over config
+func retryCount(pickle *messages.Pickle, retries uint64) (uint64, error) {
+	value, ok := tagArgument(pickle, "retry")
+	if !ok {
+		return retries, nil
+	}
+
+	count, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid @retry tag: %s", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,64 @@
+package cucumber
+
+import (
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryCount(t *testing.T) {
+	pickle := &messages.Pickle{}
+
+	count, err := retryCount(pickle, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	pickle.Tags = []*messages.Pickle_PickleTag{{Name: "@retry(3)"}}
+
+	count, err = retryCount(pickle, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	pickle.Tags = []*messages.Pickle_PickleTag{{Name: "@retry(often)"}}
+
+	_, err = retryCount(pickle, 1)
+	assert.EqualError(t, err, `invalid @retry tag: strconv.ParseUint: parsing "often": invalid syntax`)
+}
+
+func TestScenarioAttempts(t *testing.T) {
+	passed := &messages.TestResult{Status: messages.TestResult_PASSED}
+	failed := &messages.TestResult{Status: messages.TestResult_FAILED}
+	pending := &messages.TestResult{Status: messages.TestResult_PENDING}
+	undefined := &messages.TestResult{Status: messages.TestResult_UNDEFINED}
+
+	pickle := func(line uint32) *messages.Pickle {
+		return &messages.Pickle{
+			Uri:       "features/retry.feature",
+			Locations: []*messages.Location{{Line: 2}, {Line: line}},
+		}
+	}
+
+	var attempts scenarioAttempts
+
+	assert.False(t, attempts.record(pickle(10), passed, 1, false))
+	assert.True(t, attempts.record(pickle(11), failed, 1, false))
+	assert.False(t, attempts.record(pickle(13), pending, 1, false))
+	assert.False(t, attempts.success(false, false))
+
+	assert.Equal(t, map[string][]uint64{"features/retry.feature": {11}}, attempts.due())
+	assert.Empty(t, attempts.due())
+
+	assert.False(t, attempts.record(pickle(11), passed, 1, false))
+	assert.True(t, attempts.success(false, false))
+	assert.False(t, attempts.success(false, true))
+	assert.False(t, attempts.success(true, false))
+
+	// Steps which are not failed give the same result on every attempt
+	attempts = scenarioAttempts{}
+
+	assert.False(t, attempts.record(pickle(13), pending, 1, true))
+	assert.False(t, attempts.record(pickle(14), undefined, 1, false))
+	assert.Empty(t, attempts.due())
+	assert.False(t, attempts.success(false, false))
+}
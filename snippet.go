@@ -0,0 +1,210 @@
+package cucumber
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+type SnippetPatternType uint8
+
+const (
+	SnippetCucumberExpression SnippetPatternType = iota
+	SnippetRegularExpression
+)
+
+type SnippetStyleType uint8
+
+const (
+	SnippetClosure SnippetStyleType = iota
+	SnippetFunction
+)
+
+var (
+	builtinParameterGoTypes = map[string]string{
+		"int":    "int",
+		"float":  "float64",
+		"word":   "string",
+		"string": "string",
+		"":       "string",
+	}
+
+	builtinParameterRegexps = map[string]string{
+		"int":    `(-?\d+)`,
+		"float":  `(-?\d*\.\d+)`,
+		"word":   `([^\s]+)`,
+		"string": `"([^"]*)"`,
+		"":       `(.*)`,
+	}
+
+	expressionUnescaper       = strings.NewReplacer(`\(`, `(`, `\{`, `{`, `\/`, `/`)
+	generatedParameterMatcher = regexp.MustCompile(`\\?{[^}]*}`)
+)
+
+type snippetParameter struct {
+	Name   string
+	GoType string
+}
+
+// Names of snippet functions, different steps can give the same name,
+// so later ones are numbered, while the same snippet keeps its name
+type snippetNames struct {
+	bySnippet map[string]string
+	taken     map[string]bool
+}
+
+func (n *snippetNames) name(text, signature string) string {
+	if n.bySnippet == nil {
+		n.bySnippet = map[string]string{}
+		n.taken = map[string]bool{}
+	}
+
+	key := text + "\x00" + signature
+	if name, ok := n.bySnippet[key]; ok {
+		return name
+	}
+
+	base := snippetFunctionName(text)
+	name := base
+	for i := 2; n.taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+
+	n.bySnippet[key] = name
+	n.taken[name] = true
+
+	return name
+}
+
+func (s *suite) snippet(command *messages.CommandGenerateSnippet) string {
+	if len(command.GeneratedExpressions) == 0 {
+		return ""
+	}
+
+	expression := command.GeneratedExpressions[0]
+
+	var params []snippetParameter
+	for i, name := range expression.ParameterTypeNames {
+		goType, ok := builtinParameterGoTypes[name]
+		if !ok {
+			goType = "interface{}"
+		}
+		params = append(params, snippetParameter{Name: fmt.Sprintf("arg%d", i+1), GoType: goType})
+	}
+
+	if command.PickleStepArgument != nil {
+		switch command.PickleStepArgument.Message.(type) {
+		case *messages.PickleStepArgument_DocString:
+			params = append(params, snippetParameter{Name: "docString", GoType: "*cucumber.DocString"})
+		case *messages.PickleStepArgument_DataTable:
+			params = append(params, snippetParameter{Name: "table", GoType: "*cucumber.DataTable"})
+		}
+	}
+
+	pattern := expression.Text
+	if s.config.SnippetPattern == SnippetRegularExpression {
+		pattern = s.snippetRegexp(expression)
+	}
+
+	signature := "tc cucumber.TestCase"
+	for _, p := range params {
+		signature += ", " + p.Name + " " + p.GoType
+	}
+
+	var buf bytes.Buffer
+
+	switch s.config.SnippetStyle {
+	case SnippetFunction:
+		name := s.snippetNames.name(expression.Text, signature)
+		fmt.Fprintf(&buf, "func %s(%s) error {\n", name, signature)
+		fmt.Fprint(&buf, "\treturn cucumber.ErrPending\n")
+		fmt.Fprint(&buf, "}\n\n")
+		fmt.Fprintf(&buf, "s.DefineStep(%s, %s)", goString(pattern), name)
+	default:
+		fmt.Fprintf(&buf, "s.DefineStep(%s, func(%s) error {\n", goString(pattern), signature)
+		fmt.Fprint(&buf, "\treturn cucumber.ErrPending\n")
+		fmt.Fprint(&buf, "})")
+	}
+
+	return buf.String()
+}
+
+func (s *suite) snippetRegexp(expression *messages.GeneratedExpression) string {
+	text := expression.Text
+
+	var buf bytes.Buffer
+	buf.WriteString("^")
+
+	pos, i := 0, 0
+	for _, location := range generatedParameterMatcher.FindAllStringIndex(text, -1) {
+		if text[location[0]] == '\\' || i >= len(expression.ParameterTypeNames) {
+			continue
+		}
+		buf.WriteString(regexp.QuoteMeta(expressionUnescaper.Replace(text[pos:location[0]])))
+		buf.WriteString(s.parameterRegexp(expression.ParameterTypeNames[i]))
+		pos = location[1]
+		i++
+	}
+
+	buf.WriteString(regexp.QuoteMeta(expressionUnescaper.Replace(text[pos:])))
+	buf.WriteString("$")
+
+	return buf.String()
+}
+
+func (s *suite) parameterRegexp(name string) string {
+	if r, ok := builtinParameterRegexps[name]; ok {
+		return r
+	}
+
+	if pt, ok := s.parameterType(name); ok {
+		return "(" + strings.Join(pt.Regexps, "|") + ")"
+	}
+
+	return `(.*)`
+}
+
+func snippetFunctionName(text string) string {
+	text = generatedParameterMatcher.ReplaceAllString(text, " ")
+
+	var name []rune
+	upper := false
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = len(name) > 0
+			continue
+		}
+
+		if len(name) == 0 {
+			if unicode.IsDigit(r) {
+				continue
+			}
+			r = unicode.ToLower(r)
+		} else if upper {
+			r = unicode.ToUpper(r)
+		}
+
+		name = append(name, r)
+		upper = false
+	}
+
+	if len(name) == 0 {
+		return "step"
+	}
+
+	return string(name)
+}
+
+func goString(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+
+	return "`" + s + "`"
+}
@@ -0,0 +1,64 @@
+package cucumber
+
+import (
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippet(t *testing.T) {
+	s := &suite{}
+	command := &messages.CommandGenerateSnippet{
+		GeneratedExpressions: []*messages.GeneratedExpression{
+			{Text: "you concat {string} and {int}", ParameterTypeNames: []string{"string", "int"}},
+			{Text: "you concat {string} and {float}", ParameterTypeNames: []string{"string", "float"}},
+		},
+	}
+
+	assert.Equal(t, "s.DefineStep(`you concat {string} and {int}`, func(tc cucumber.TestCase, arg1 string, arg2 int) error {\n"+
+		"\treturn cucumber.ErrPending\n"+
+		"})", s.snippet(command))
+
+	s.config.SnippetPattern = SnippetRegularExpression
+	s.config.SnippetStyle = SnippetFunction
+	command.PickleStepArgument = &messages.PickleStepArgument{
+		Message: &messages.PickleStepArgument_DataTable{
+			DataTable: &messages.PickleStepArgument_PickleTable{},
+		},
+	}
+
+	assert.Equal(t, "func youConcatAnd(tc cucumber.TestCase, arg1 string, arg2 int, table *cucumber.DataTable) error {\n"+
+		"\treturn cucumber.ErrPending\n"+
+		"}\n\n"+
+		"s.DefineStep(`^you concat \"([^\"]*)\" and (-?\\d+)$`, youConcatAnd)", s.snippet(command))
+
+	assert.Equal(t, "", s.snippet(&messages.CommandGenerateSnippet{}))
+}
+
+func TestSnippetRegexp(t *testing.T) {
+	s := &suite{
+		parameterTypes: []parameterType{{Name: "color", Regexps: []string{"red", "blue"}}},
+	}
+
+	assert.Equal(t, `^paint it (red|blue) for \$(-?\d*\.\d+) \(or \{less\}\)$`, s.snippetRegexp(&messages.GeneratedExpression{
+		Text:               `paint it {color} for ${float} \(or \{less})`,
+		ParameterTypeNames: []string{"color", "float"},
+	}))
+}
+
+func TestSnippetNames(t *testing.T) {
+	var names snippetNames
+
+	assert.Equal(t, "youHaveCukes", names.name("you have {int} cukes", "tc cucumber.TestCase, arg1 int"))
+	assert.Equal(t, "youHaveCukes2", names.name("you have {float} cukes", "tc cucumber.TestCase, arg1 float64"))
+	assert.Equal(t, "youHaveCukes3", names.name("you have {int} cukes", "tc cucumber.TestCase, arg1 int, table *cucumber.DataTable"))
+	assert.Equal(t, "youHaveCukes", names.name("you have {int} cukes", "tc cucumber.TestCase, arg1 int"))
+}
+
+func TestSnippetFunctionName(t *testing.T) {
+	assert.Equal(t, "youHave", snippetFunctionName("you have {int}"))
+	assert.Equal(t, "youHaveCukesInYourBelly", snippetFunctionName("You have cukes in your-belly"))
+	assert.Equal(t, "cukes", snippetFunctionName("3 cukes"))
+	assert.Equal(t, "step", snippetFunctionName("{int}"))
+}
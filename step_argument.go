@@ -0,0 +1,55 @@
+package cucumber
+
+import (
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Doc string passed to the step, e.g.
+//
+//	"""json
+//	{"foo": "bar"}
+//	"""
+type DocString struct {
+	Content     string
+	ContentType string
+}
+
+// Data table passed to the step, e.g.
+//
+//	| name | age |
+//	| John | 42  |
+type DataTable struct {
+	Rows [][]string
+
+	uri       string
+	locations [][]*messages.Location
+}
+
+func newStepArgument(uri string, argument *messages.PickleStepArgument) interface{} {
+	if argument == nil {
+		return nil
+	}
+
+	switch x := argument.Message.(type) {
+	case *messages.PickleStepArgument_DocString:
+		return &DocString{
+			Content:     x.DocString.Content,
+			ContentType: x.DocString.ContentType,
+		}
+	case *messages.PickleStepArgument_DataTable:
+		dt := &DataTable{uri: uri}
+		for _, row := range x.DataTable.Rows {
+			var values []string
+			var locations []*messages.Location
+			for _, cell := range row.Cells {
+				values = append(values, cell.Value)
+				locations = append(locations, cell.Location)
+			}
+			dt.Rows = append(dt.Rows, values)
+			dt.locations = append(dt.locations, locations)
+		}
+		return dt
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package cucumber
+
+import (
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStepArgument(t *testing.T) {
+	assert.Nil(t, newStepArgument("a.feature", nil))
+
+	argument := newStepArgument("a.feature", &messages.PickleStepArgument{
+		Message: &messages.PickleStepArgument_DocString{
+			DocString: &messages.PickleStepArgument_PickleDocString{
+				Content:     `{"foo": "bar"}`,
+				ContentType: "json",
+			},
+		},
+	})
+	assert.Equal(t, &DocString{Content: `{"foo": "bar"}`, ContentType: "json"}, argument)
+
+	argument = newStepArgument("a.feature", &messages.PickleStepArgument{
+		Message: &messages.PickleStepArgument_DataTable{
+			DataTable: &messages.PickleStepArgument_PickleTable{
+				Rows: []*messages.PickleStepArgument_PickleTable_PickleTableRow{
+					{Cells: []*messages.PickleStepArgument_PickleTable_PickleTableRow_PickleTableCell{
+						{Value: "name", Location: &messages.Location{Line: 2, Column: 5}},
+						{Value: "age", Location: &messages.Location{Line: 2, Column: 12}},
+					}},
+					{Cells: []*messages.PickleStepArgument_PickleTable_PickleTableRow_PickleTableCell{
+						{Value: "John", Location: &messages.Location{Line: 3, Column: 5}},
+						{Value: "42", Location: &messages.Location{Line: 3, Column: 12}},
+					}},
+				},
+			},
+		},
+	})
+	if assert.IsType(t, &DataTable{}, argument) {
+		assert.Equal(t, [][]string{{"name", "age"}, {"John", "42"}}, argument.(*DataTable).Rows)
+	}
+}
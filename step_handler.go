@@ -0,0 +1,248 @@
+package cucumber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	testCaseType = reflect.TypeOf((*TestCase)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+
+	docStringType = reflect.TypeOf((*DocString)(nil))
+	dataTableType = reflect.TypeOf((*DataTable)(nil))
+)
+
+// Step handler is any function accepting TestCase followed by
+// step arguments and returning an error, e.g.
+// func(tc TestCase, n int, name string, ratio float64) error
+// Steps with doc string or data table can accept it as the last
+// *DocString or *DataTable parameter.
+// Handler may accept context.Context before TestCase, it is cancelled
+// when the step times out or the run is stopped.
+// When suite defines a world, handler may accept the world instead of
+// TestCase, optionally followed by TestCase, e.g.
+// func(w *World, tc TestCase, n int) error
+type stepHandler struct {
+	fn       reflect.Value
+	context  bool
+	world    reflect.Type
+	testCase bool
+	args     []reflect.Type
+	argument reflect.Type
+}
+
+func newStepHandler(fn interface{}, argc int, world reflect.Type) (*stepHandler, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("step handler must be a function, got %s", t)
+	}
+
+	if t.NumOut() != 1 || t.Out(0) != errorType {
+		return nil, errors.New("step handler must return error")
+	}
+
+	h := &stepHandler{fn: v}
+
+	i := 0
+	if i < t.NumIn() && t.In(i) == contextType {
+		h.context = true
+		i++
+	}
+
+	switch {
+	case i < t.NumIn() && t.In(i) == testCaseType:
+		h.testCase = true
+		i++
+	case world != nil && i < t.NumIn() && t.In(i) == world:
+		h.world = world
+		i++
+
+		if i < t.NumIn() && t.In(i) == testCaseType {
+			h.testCase = true
+			i++
+		}
+	case world != nil:
+		return nil, fmt.Errorf("step handler must accept TestCase or world %s as the first argument", world)
+	default:
+		return nil, errors.New("step handler must accept TestCase as the first argument")
+	}
+
+	var args []reflect.Type
+	for ; i < t.NumIn(); i++ {
+		args = append(args, t.In(i))
+	}
+
+	var argument reflect.Type
+	if n := len(args); n > 0 && !t.IsVariadic() && (args[n-1] == docStringType || args[n-1] == dataTableType) {
+		argument = args[n-1]
+		args = args[:n-1]
+	}
+
+	if t.IsVariadic() {
+		if argc < len(args)-1 {
+			return nil, fmt.Errorf("step handler expects at least %d arguments but pattern has %d", len(args)-1, argc)
+		}
+	} else if argc != len(args) {
+		return nil, fmt.Errorf("step handler expects %d arguments but pattern has %d", len(args), argc)
+	}
+
+	h.args = args
+	h.argument = argument
+
+	return h, nil
+}
+
+func (h *stepHandler) call(ctx context.Context, tc TestCase, args []interface{}, argument interface{}) error {
+	var in []reflect.Value
+	if h.context {
+		in = append(in, reflect.ValueOf(&ctx).Elem())
+	}
+	if h.world != nil {
+		world := reflect.ValueOf(tc.World())
+		if !world.IsValid() {
+			return fmt.Errorf("step handler expects world %s but scenario has none", h.world)
+		}
+		in = append(in, world)
+	}
+	if h.testCase {
+		in = append(in, reflect.ValueOf(&tc).Elem())
+	}
+
+	for i, arg := range args {
+		t := h.argType(i)
+
+		v, err := convertArgument(arg, t)
+		if err != nil {
+			return fmt.Errorf("argument %d (%s): %s", i+1, t, err)
+		}
+
+		in = append(in, v)
+	}
+
+	if h.argument != nil {
+		if argument == nil {
+			return fmt.Errorf("step handler expects %s but step has none", h.argument)
+		}
+
+		if reflect.TypeOf(argument) != h.argument {
+			return fmt.Errorf("step handler expects %s but step has %T", h.argument, argument)
+		}
+
+		in = append(in, reflect.ValueOf(argument))
+	}
+
+	out := h.fn.Call(in)
+
+	err, _ := out[0].Interface().(error)
+	return err
+}
+
+func (h *stepHandler) argType(i int) reflect.Type {
+	if h.fn.Type().IsVariadic() && i >= len(h.args)-1 {
+		return h.args[len(h.args)-1].Elem()
+	}
+
+	return h.args[i]
+}
+
+func convertArgument(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(t), nil
+	}
+
+	v := reflect.ValueOf(arg)
+
+	if v.Type().AssignableTo(t) {
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		return out, nil
+	}
+
+	s, ok := arg.(string)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("cannot use %T value %v", arg, arg)
+	}
+
+	out := reflect.New(t).Elem()
+
+	if t == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+		}
+		out.SetInt(int64(d))
+		return out, nil
+	}
+
+	if t == timeType {
+		tm, err := parseTime(s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+		}
+		out.Set(reflect.ValueOf(tm))
+		return out, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		out.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+		}
+		out.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+		}
+		out.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+		}
+		out.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+		}
+		out.SetBool(b)
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot convert %q to %s", s, t)
+	}
+
+	return out, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, error) {
+	var err error
+
+	for _, layout := range timeLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
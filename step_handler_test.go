@@ -0,0 +1,117 @@
+package cucumber
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStepHandler(t *testing.T) {
+	_, err := newStepHandler(func(TestCase, ...string) error { return nil }, 2, nil)
+	assert.NoError(t, err)
+
+	_, err = newStepHandler(func(TestCase, int, ...string) error { return nil }, 1, nil)
+	assert.NoError(t, err)
+
+	_, err = newStepHandler(func(TestCase, int, string) error { return nil }, 2, nil)
+	assert.NoError(t, err)
+
+	_, err = newStepHandler(func(TestCase, int, string) error { return nil }, 1, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler expects 2 arguments but pattern has 1", err.Error())
+	}
+
+	_, err = newStepHandler(func(TestCase, int, string, ...string) error { return nil }, 1, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler expects at least 2 arguments but pattern has 1", err.Error())
+	}
+
+	_, err = newStepHandler(func(TestCase) {}, 0, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler must return error", err.Error())
+	}
+
+	_, err = newStepHandler(func(int) error { return nil }, 1, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler must accept TestCase as the first argument", err.Error())
+	}
+
+	_, err = newStepHandler("foo", 0, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler must be a function, got string", err.Error())
+	}
+
+	_, err = newStepHandler(func(context.Context, TestCase, int) error { return nil }, 1, nil)
+	assert.NoError(t, err)
+
+	_, err = newStepHandler(func(context.Context, int) error { return nil }, 1, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler must accept TestCase as the first argument", err.Error())
+	}
+}
+
+func TestStepHandlerCall(t *testing.T) {
+	var (
+		n     int
+		name  string
+		ratio float64
+		ok    bool
+		d     time.Duration
+	)
+
+	h, err := newStepHandler(func(_ TestCase, a int, b string, c float64, e bool, f time.Duration) error {
+		n, name, ratio, ok, d = a, b, c, e, f
+		return nil
+	}, 5, nil)
+	assert.NoError(t, err)
+
+	err = h.call(context.Background(), newTestCase(nil, nil), []interface{}{"-3", "foo", "1.5", "true", "2s"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, -3, n)
+	assert.Equal(t, "foo", name)
+	assert.Equal(t, 1.5, ratio)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, d)
+
+	err = h.call(context.Background(), newTestCase(nil, nil), []interface{}{"many", "foo", "1.5", "true", "2s"}, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, `argument 1 (int): cannot convert "many" to int`, err.Error())
+	}
+
+	h, err = newStepHandler(func(_ TestCase, args ...interface{}) error {
+		return errors.New(args[0].(string) + args[1].(string))
+	}, 2, nil)
+	assert.NoError(t, err)
+
+	err = h.call(context.Background(), newTestCase(nil, nil), []interface{}{"foo", "bar"}, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "foobar", err.Error())
+	}
+
+	h, err = newStepHandler(func(_ TestCase, s string) error { return nil }, 1, nil)
+	assert.NoError(t, err)
+
+	err = h.call(context.Background(), newTestCase(nil, nil), []interface{}{42}, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "argument 1 (string): cannot use int value 42", err.Error())
+	}
+}
+
+func TestStepHandlerCallWithContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+
+	var got interface{}
+	h, err := newStepHandler(func(ctx context.Context, _ TestCase, n int) error {
+		got = ctx.Value(key{})
+		return nil
+	}, 1, nil)
+	assert.NoError(t, err)
+
+	err = h.call(ctx, newTestCase(nil, nil), []interface{}{"1"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", got)
+}
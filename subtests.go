@@ -0,0 +1,279 @@
+package cucumber
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Runs the suite as subtests of t, a subtest per feature with nested subtests per scenario.
+// Scenarios run in order of definition, go test -run selects them by name and scenario
+// subtests are parallel when configuration allows more than one scenario at once.
+// Failed scenarios are not retried, use go test -count to repeat them.
+func (s *suite) RunTest(t *testing.T, options ...RunOption) {
+	tests := newSubtests(s.config.Strict)
+	s.tests = tests
+	defer func() { s.tests = nil }()
+
+	options = append(options[:len(options):len(options)], func(c *Config) {
+		c.Order = OrderDefinition
+		c.Retry = 0
+	})
+
+	var result *Result
+	var err error
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		result, err = s.RunContext(context.Background(), options...)
+	}()
+
+	var pickles []*messages.Pickle
+	select {
+	case pickles = <-tests.discovered:
+	case <-finished:
+	}
+
+	parallel := s.maxParallel() > 1
+
+	for _, feature := range tests.groupByFeature(pickles) {
+		feature := feature
+
+		t.Run(feature.name, func(t *testing.T) {
+			for _, pickle := range feature.pickles {
+				pickle := pickle
+
+				selected := t.Run(subtestName(pickle), func(t *testing.T) {
+					tests.decide(pickle.Id, true)
+
+					if parallel {
+						t.Parallel()
+					}
+
+					tests.report(t, pickle.Id, finished)
+				})
+
+				if !selected {
+					tests.decide(pickle.Id, false)
+				}
+			}
+		})
+
+		// Scenarios of features filtered out by -run are skipped
+		for _, pickle := range feature.pickles {
+			tests.decide(pickle.Id, false)
+		}
+	}
+
+	<-finished
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if result != nil {
+		for _, message := range result.Errors {
+			t.Error(message)
+		}
+	}
+}
+
+// Scenario subtests decide which scenarios cucumber-engine runs and report their results.
+// cucumber-engine runs scenarios in order of definition, so a scenario waits only for
+// subtests defined before it.
+type subtests struct {
+	discovered chan []*messages.Pickle
+	features   map[string]string
+	pickles    map[string]*messages.Pickle
+	accepted   []*messages.Pickle
+	selection  map[string]chan bool
+	outcomes   map[string]chan subtestOutcome
+	failures   map[string][]string
+	strict     bool
+	mu         sync.Mutex
+}
+
+type subtestOutcome struct {
+	status   messages.TestResult_Status
+	message  string
+	failures []string
+}
+
+type subtestFeature struct {
+	name    string
+	pickles []*messages.Pickle
+}
+
+func newSubtests(strict bool) *subtests {
+	return &subtests{
+		discovered: make(chan []*messages.Pickle, 1),
+		features:   map[string]string{},
+		pickles:    map[string]*messages.Pickle{},
+		selection:  map[string]chan bool{},
+		outcomes:   map[string]chan subtestOutcome{},
+		failures:   map[string][]string{},
+		strict:     strict,
+	}
+}
+
+func (st *subtests) ProcessMessage(msg *messages.Envelope) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	switch m := msg.Message.(type) {
+	case *messages.Envelope_GherkinDocument:
+		if m.GherkinDocument.Feature != nil {
+			st.features[m.GherkinDocument.Uri] = m.GherkinDocument.Feature.Name
+		}
+	case *messages.Envelope_Pickle:
+		st.pickles[m.Pickle.Id] = m.Pickle
+	case *messages.Envelope_PickleAccepted:
+		pickle := st.pickles[m.PickleAccepted.PickleId]
+		st.accepted = append(st.accepted, pickle)
+		st.selection[pickle.Id] = make(chan bool, 1)
+		st.outcomes[pickle.Id] = make(chan subtestOutcome, 1)
+	case *messages.Envelope_CommandRunBeforeTestRunHooks:
+		// Sent once all pickles are known, before any scenario starts
+		st.discovered <- st.accepted
+	case *messages.Envelope_TestStepFinished:
+		pickle := st.pickles[m.TestStepFinished.PickleId]
+		step := pickle.Steps[m.TestStepFinished.Index]
+		location := fmt.Sprintf("%s:%d", pickle.Uri, step.Locations[len(step.Locations)-1].Line)
+		result := m.TestStepFinished.TestResult
+
+		switch result.Status {
+		case messages.TestResult_FAILED, messages.TestResult_AMBIGUOUS:
+			st.failures[pickle.Id] = append(st.failures[pickle.Id], fmt.Sprintf("%s: %s: %s", location, step.Text, result.Message))
+		case messages.TestResult_UNDEFINED:
+			st.failures[pickle.Id] = append(st.failures[pickle.Id], fmt.Sprintf("%s: %s: undefined step", location, step.Text))
+		case messages.TestResult_PENDING:
+			if st.strict {
+				st.failures[pickle.Id] = append(st.failures[pickle.Id], fmt.Sprintf("%s: %s: pending step", location, step.Text))
+			}
+		}
+	case *messages.Envelope_TestHookFinished:
+		if m.TestHookFinished.PickleId == "" || m.TestHookFinished.TestResult.Status != messages.TestResult_FAILED {
+			break
+		}
+
+		pickle := st.pickles[m.TestHookFinished.PickleId]
+		location := fmt.Sprintf("%s:%d", pickle.Uri, pickle.Locations[len(pickle.Locations)-1].Line)
+		st.failures[pickle.Id] = append(st.failures[pickle.Id], fmt.Sprintf("%s: hook: %s", location, m.TestHookFinished.TestResult.Message))
+	case *messages.Envelope_TestCaseFinished:
+		pickleId := m.TestCaseFinished.PickleId
+
+		if outcome, ok := st.outcomes[pickleId]; ok {
+			outcome <- subtestOutcome{
+				status:   m.TestCaseFinished.TestResult.Status,
+				message:  m.TestCaseFinished.TestResult.Message,
+				failures: st.failures[pickleId],
+			}
+		}
+		delete(st.failures, pickleId)
+	}
+}
+
+// Groups discovered scenarios by feature in order of definition
+func (st *subtests) groupByFeature(pickles []*messages.Pickle) []*subtestFeature {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var features []*subtestFeature
+	byUri := map[string]*subtestFeature{}
+
+	for _, pickle := range pickles {
+		feature, ok := byUri[pickle.Uri]
+		if !ok {
+			name := st.features[pickle.Uri]
+			if name == "" {
+				name = pickle.Uri
+			}
+
+			feature = &subtestFeature{name: name}
+			byUri[pickle.Uri] = feature
+			features = append(features, feature)
+		}
+
+		feature.pickles = append(feature.pickles, pickle)
+	}
+
+	return features
+}
+
+// Decides whether scenario runs, only the first decision counts
+func (st *subtests) decide(pickleId string, selected bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	select {
+	case st.selection[pickleId] <- selected:
+	default:
+	}
+}
+
+// Blocks until subtest of the scenario starts or is filtered out
+func (st *subtests) selected(pickleId string, done <-chan struct{}) bool {
+	st.mu.Lock()
+	selection, ok := st.selection[pickleId]
+	st.mu.Unlock()
+
+	if !ok {
+		return true
+	}
+
+	select {
+	case selected := <-selection:
+		return selected
+	case <-done:
+		return false
+	}
+}
+
+// Waits for the scenario to finish and reports it to the subtest
+func (st *subtests) report(t *testing.T, pickleId string, finished <-chan struct{}) {
+	st.mu.Lock()
+	outcomes := st.outcomes[pickleId]
+	st.mu.Unlock()
+
+	var outcome subtestOutcome
+	select {
+	case outcome = <-outcomes:
+	case <-finished:
+		select {
+		case outcome = <-outcomes:
+		default:
+			t.Fatal("run stopped before the scenario finished")
+		}
+	}
+
+	for _, failure := range outcome.failures {
+		t.Error(failure)
+	}
+
+	if t.Failed() {
+		return
+	}
+
+	switch outcome.status {
+	case messages.TestResult_SKIPPED:
+		if outcome.message != "" {
+			t.Skip(outcome.message)
+		}
+		t.Skip("skipped")
+	case messages.TestResult_PENDING:
+		t.Skip("pending")
+	}
+}
+
+// Scenarios from outlines are named by their example row
+func subtestName(pickle *messages.Pickle) string {
+	if len(pickle.Locations) > 1 {
+		return fmt.Sprintf("%s (line %d)", pickle.Name, pickle.Locations[len(pickle.Locations)-1].Line)
+	}
+
+	return pickle.Name
+}
@@ -1,16 +1,22 @@
 package cucumber
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"reflect"
 	"regexp"
+	"runtime"
 	"runtime/debug"
+	"sort"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/cucumber/cucumber-engine/src/runner"
@@ -24,29 +30,119 @@ const (
 	OrderDefinition
 )
 
+// Exit code of interrupted runs, the same as shells use for SIGINT
+const exitCodeInterrupted = 130
+
 var (
 	ErrPending = errors.New("implementation pending")
 
+	// Skips the scenario without a reason, use Skip to give one
+	ErrSkipped = errors.New("skipped")
+
+	// Reported to formatters when the run is stopped by SIGINT or SIGTERM
+	ErrInterrupted = errors.New("interrupted")
+
+	errFailNow = errors.New("stopped by FailNow")
+
 	lineFilterMatcher = regexp.MustCompile(`:\d+$`)
 )
 
-type stepHandlerFunc func(TestCase, ...string) error
-
 type testCaseInitializerFunc func(TestCase) error
 
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return "skipped: " + e.reason
+}
+
+// Returns error which marks the step or hook returning it as skipped
+// together with the remaining steps of the scenario
+func Skip(reason string) error {
+	return &skipError{reason: reason}
+}
+
 type stepDefinition struct {
-	Pattern string
-	Handler stepHandlerFunc
+	Pattern     string
+	PatternType messages.StepDefinitionPatternType
+	Handler     *stepHandler
+	Timeout     time.Duration
+}
+
+// Step definition option passed to DefineStep
+type StepOption func(*stepDefinition)
+
+// Run option passed to Run or RunContext, overrides configuration for a single run
+type RunOption func(*Config)
+
+// Runs only scenarios matching tag expression
+func WithTags(tagExpression string) RunOption {
+	return func(c *Config) {
+		c.TagExpression = tagExpression
+	}
+}
+
+// Runs features in given paths, paths may end with :line
+func WithPaths(paths ...string) RunOption {
+	return func(c *Config) {
+		c.Paths = paths
+	}
+}
+
+// Orders scenarios with given seed
+func WithSeed(seed uint64) RunOption {
+	return func(c *Config) {
+		c.Seed = seed
+	}
+}
+
+// Reports the run to given formatter
+func WithFormatter(formatter Formatter) RunOption {
+	return func(c *Config) {
+		c.Formatter = formatter
+	}
+}
+
+// Overrides Config.StepTimeout for the step definition,
+// @timeout(duration) scenario tag takes precedence over it
+func WithStepTimeout(timeout time.Duration) StepOption {
+	return func(sd *stepDefinition) {
+		sd.Timeout = timeout
+	}
 }
 
 type suite struct {
 	config              Config
 	baseDirectory       string
-	files               []string
-	lineFilters         map[string][]uint64
 	stepDefinitions     []stepDefinition
+	parameterTypes      []parameterType
+	beforeHooks         []hookDefinition
+	afterHooks          []hookDefinition
+	beforeStepHooks     []stepHookDefinition
+	afterStepHooks      []stepHookDefinition
+	beforeAllHooks      []testRunHookDefinition
+	afterAllHooks       []testRunHookDefinition
+	aborted             bool
+	testRunFailed       bool
+	retryErr            error
 	testCases           sync.Map
+	documents           map[string]*messages.GherkinDocument
 	testCaseInitializer testCaseInitializerFunc
+	world               *worldFactory
+	fixtures            fixtures
+	locks               scenarioLocks
+	attempts            scenarioAttempts
+	retrying            bool
+	retried             bool
+	collector           *resultCollector
+	snippetNames        snippetNames
+	tests               *subtests
+	work                chan func()
+	stopped             chan struct{}
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	formatterLock       sync.Mutex
 	incoming            chan *messages.Envelope
 	outgoing            chan *messages.Envelope
 }
@@ -75,53 +171,40 @@ func NewSuite(config Config, args ...string) (*suite, error) {
 	fs.Uint64Var(&config.Seed, "seed", config.Seed, "")
 	fs.Uint64Var(&config.Concurrency, "concurrency", config.Concurrency, "")
 	fs.Uint64Var(&config.Concurrency, "c", config.Concurrency, "")
+	fs.Uint64Var(&config.ScenarioConcurrency, "scenario-concurrency", config.ScenarioConcurrency, "")
 	fs.BoolVar(&config.FailFast, "fast", config.FailFast, "")
 	fs.BoolVar(&config.DryRun, "dry", config.DryRun, "")
 	fs.BoolVar(&config.Strict, "strict", config.Strict, "")
+	fs.DurationVar(&config.StepTimeout, "timeout", config.StepTimeout, "")
+	fs.Uint64Var(&config.Retry, "retry", config.Retry, "")
+	fs.BoolVar(&config.StrictFlaky, "strict-flaky", config.StrictFlaky, "")
 	err := fs.Parse(args)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.ScenarioConcurrency == 0 {
+		config.ScenarioConcurrency = uint64(runtime.GOMAXPROCS(0))
+	}
+
 	if len(fs.Args()) > 0 {
 		config.Paths = fs.Args()
 	}
 
-	e := runner.NewRunner()
-	incoming, outgoing := e.GetCommandChannels()
-
 	baseDirectory, err := os.Getwd()
 	if err != nil {
 		return nil, err
 	}
 
-	var files []string
-	lineFilters := map[string][]uint64{}
-
-	for _, path := range config.Paths {
-		line := lineFilterMatcher.FindString(path)
-		if line != "" {
-			path = strings.TrimSuffix(path, line)
-			lineNumber, _ := strconv.ParseUint(line[1:], 10, 0)
-
-			lineFilters[path] = append(lineFilters[path], lineNumber)
-		}
-
-		filesForPath, err := findFeatures(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find features in path: %s", path)
-		}
-		files = append(files, filesForPath...)
+	// Paths are resolved again by every run, missing ones are reported early
+	if _, _, err := findFeatureFiles(config.Paths); err != nil {
+		return nil, err
 	}
 
 	suite := &suite{
 		config:              config,
 		baseDirectory:       baseDirectory,
-		files:               files,
-		lineFilters:         lineFilters,
 		testCaseInitializer: func(TestCase) error { return nil },
-		incoming:            incoming,
-		outgoing:            outgoing,
 	}
 
 	return suite, nil
@@ -131,28 +214,318 @@ func (s *suite) DefineTestCaseInitializer(fn testCaseInitializerFunc) {
 	s.testCaseInitializer = fn
 }
 
-func (s *suite) DefineStep(pattern string, fn stepHandlerFunc) {
-	s.stepDefinitions = append(s.stepDefinitions, stepDefinition{
-		Pattern: pattern,
-		Handler: fn,
+// Defines factory returning a pointer to a fresh world struct for each scenario,
+// e.g. func() *World. Step handlers defined afterwards may accept the world
+// instead of TestCase, so the world is defined before any step.
+// Panics if factory is not a valid world factory or steps are already defined.
+func (s *suite) DefineWorld(fn interface{}) {
+	if len(s.stepDefinitions) > 0 {
+		panic("invalid world: world must be defined before steps")
+	}
+
+	world, err := newWorldFactory(fn)
+	if err != nil {
+		panic(fmt.Sprintf("invalid world: %s", err))
+	}
+
+	s.world = world
+}
+
+// Defines fixture shared by all scenarios, provider is called once
+// on first use and returned teardown is run after all scenarios
+func (s *suite) DefineFixture(name string, fn fixtureProviderFunc) {
+	s.fixtures.define(name, fn)
+}
+
+// Patterns starting with ^ or ending with $ are treated as regular
+// expressions, otherwise pattern is expected to be a Cucumber Expression.
+// Handler is a function accepting TestCase followed by step arguments,
+// which are converted to the types of handler parameters, e.g.
+// func(tc TestCase, n int, name string, ratio float64) error
+// Handler accepting context.Context before TestCase can stop
+// when the step times out or the run is stopped.
+// Panics if handler does not match the pattern.
+func (s *suite) DefineStep(pattern string, fn interface{}, options ...StepOption) {
+	pt := patternType(pattern)
+
+	argc, err := argumentCount(pattern, pt)
+	if err != nil {
+		panic(fmt.Sprintf("invalid step pattern %q: %s", pattern, err))
+	}
+
+	var world reflect.Type
+	if s.world != nil {
+		world = s.world.world
+	}
+
+	handler, err := newStepHandler(fn, argc, world)
+	if err != nil {
+		panic(fmt.Sprintf("invalid step definition %q: %s", pattern, err))
+	}
+
+	sd := stepDefinition{
+		Pattern:     pattern,
+		PatternType: pt,
+		Handler:     handler,
+	}
+
+	for _, option := range options {
+		option(&sd)
+	}
+
+	s.stepDefinitions = append(s.stepDefinitions, sd)
+}
+
+// Defines parameter type which can be used in Cucumber Expressions as {name}.
+// Captured strings are converted by transformer before they are passed to
+// the step handler, nil transformer passes the first capture unchanged.
+func (s *suite) DefineParameterType(name string, regexps []string, fn parameterTransformerFunc) {
+	s.parameterTypes = append(s.parameterTypes, parameterType{
+		Name:        name,
+		Regexps:     regexps,
+		Transformer: fn,
 	})
 }
 
-func (s *suite) Run() int {
+// Defines hook to run before each scenario matching tag expression,
+// empty tag expression matches all scenarios
+func (s *suite) DefineBefore(tagExpression string, fn beforeHookFunc) {
+	s.beforeHooks = append(s.beforeHooks, newHookDefinition(tagExpression, func(tc TestCase, _ ScenarioResult) error {
+		return fn(tc)
+	}))
+}
+
+// Defines hook to run after each scenario matching tag expression,
+// it runs even if the scenario has failed and receives its result
+func (s *suite) DefineAfter(tagExpression string, fn afterHookFunc) {
+	s.afterHooks = append(s.afterHooks, newHookDefinition(tagExpression, fn))
+}
+
+// Defines hook to run before each step of scenarios matching tag expression,
+// failure fails the step without running it
+func (s *suite) DefineBeforeStep(tagExpression string, fn beforeStepHookFunc) {
+	s.beforeStepHooks = append(s.beforeStepHooks, newStepHookDefinition(tagExpression, func(tc TestCase, step Step, _ StepResult) error {
+		return fn(tc, step)
+	}))
+}
+
+// Defines hook to run after each step of scenarios matching tag expression,
+// it runs even if the step has failed and receives its result
+func (s *suite) DefineAfterStep(tagExpression string, fn afterStepHookFunc) {
+	s.afterStepHooks = append(s.afterStepHooks, newStepHookDefinition(tagExpression, fn))
+}
+
+// Defines hook to run once before all scenarios,
+// failure aborts the run
+func (s *suite) DefineBeforeAll(fn testRunHookFunc) {
+	s.beforeAllHooks = append(s.beforeAllHooks, newTestRunHookDefinition("before all hook", fn))
+}
+
+// Defines hook to run once after all scenarios
+func (s *suite) DefineAfterAll(fn testRunHookFunc) {
+	s.afterAllHooks = append(s.afterAllHooks, newTestRunHookDefinition("after all hook", fn))
+}
+
+// Runs the suite returning exit code, 1 when the run fails
+// and 130 when it is interrupted by SIGINT or SIGTERM
+func (s *suite) Run(options ...RunOption) int {
+	var interrupted int32
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), interruptKey{}, &interrupted))
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go handleSignals(signals, done, &interrupted, cancel)
+
+	result, err := s.RunContext(ctx, options...)
+
+	if err == ErrInterrupted {
+		return exitCodeInterrupted
+	} else if err != nil || !result.Success {
+		return 1
+	} else {
+		return 0
+	}
+}
+
+// Runs the suite until all scenarios finish or ctx is cancelled. Failing scenarios
+// are reported by the result, error is returned together with the partial result
+// when ctx is cancelled, the run is interrupted or cucumber-engine fails.
+// The suite can be run again, but runs must not overlap.
+func (s *suite) RunContext(ctx context.Context, options ...RunOption) (*Result, error) {
+	config := s.config
+	defer func() { s.config = config }()
+
+	for _, option := range options {
+		option(&s.config)
+	}
+
+	files, lineFilters, err := findFeatureFiles(s.config.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// cucumber-engine closes its channels once the run finishes,
+	// so every run starts a new one and resets state of the previous run
+	s.incoming, s.outgoing = runner.NewRunner().GetCommandChannels()
+	s.documents = map[string]*messages.GherkinDocument{}
+	s.collector = newResultCollector()
+	s.snippetNames = snippetNames{}
+	s.attempts = scenarioAttempts{}
+	s.testRunFailed, s.aborted, s.retried = false, false, false
+	s.retryErr = nil
+	s.fixtures.reset()
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	defer s.cancel()
+
+	// cucumber-engine awaits each command of a scenario before sending the next one,
+	// so a worker per scenario in flight is enough
+	work := make(chan func(), s.maxParallel())
+	s.work = work
+	s.stopped = make(chan struct{})
+
+	var workers sync.WaitGroup
+	for i := uint64(0); i < s.maxParallel(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for fn := range work {
+				fn()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go s.notifyInterrupt(ctx, done)
+
+	s.respond(s.startCommand(files, lineFilters))
+
+	err = s.listen()
+	if err == nil {
+		err = s.retryErr
+	}
+
+	// cucumber-engine stops awaiting responses when it fails, so scenarios still
+	// in flight are abandoned with their locks before workers are stopped
+	close(s.stopped)
+	s.cancel()
+	s.testCases.Range(func(pickleId, tc interface{}) bool {
+		tc.(*testCase).releaseLocks()
+		s.testCases.Delete(pickleId)
+		return true
+	})
+	close(work)
+	workers.Wait()
+
+	result := s.collector.finish()
+	result.Seed = s.config.Seed
+	result.Config = s.config
+	result.Interrupted = s.isInterrupted()
+
+	if err == nil && result.Interrupted {
+		err = ErrInterrupted
+	} else if err == nil {
+		err = ctx.Err()
+	}
+
+	return result, err
+}
+
+// Marks context of a run that is cancelled by a signal
+type interruptKey struct{}
+
+// First signal stops the run letting after hooks and formatters finish,
+// second signal exits immediately
+func handleSignals(signals <-chan os.Signal, done <-chan struct{}, interrupted *int32, cancel context.CancelFunc) {
+	select {
+	case <-signals:
+	case <-done:
+		return
+	}
+
+	atomic.StoreInt32(interrupted, 1)
+	cancel()
+
+	select {
+	case <-signals:
+		os.Exit(exitCodeInterrupted)
+	case <-done:
+	}
+}
+
+// Tells formatters that the run is interrupted once ctx is cancelled by a signal
+func (s *suite) notifyInterrupt(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-done:
+		return
+	}
+
+	if isInterrupted(ctx) {
+		s.process(&messages.Envelope{
+			Message: &messages.Envelope_CommandError{
+				CommandError: ErrInterrupted.Error(),
+			},
+		})
+	}
+}
+
+func isInterrupted(ctx context.Context) bool {
+	interrupted, ok := ctx.Value(interruptKey{}).(*int32)
+	return ok && atomic.LoadInt32(interrupted) == 1
+}
+
+func (s *suite) isInterrupted() bool {
+	return isInterrupted(s.ctx)
+}
+
+// cucumber-engine runs a step per scenario in flight at once,
+// so both limits bound scenarios and the lower one applies
+func (s *suite) maxParallel() uint64 {
+	if s.config.Concurrency > 0 && s.config.Concurrency < s.config.ScenarioConcurrency {
+		return s.config.Concurrency
+	}
+
+	return s.config.ScenarioConcurrency
+}
+
+func (s *suite) startCommand(files []string, lineFilters map[string][]uint64) *messages.Envelope {
 	var stepDefinitionConfig []*messages.StepDefinitionConfig
 
 	for i, sd := range s.stepDefinitions {
 		stepDefinitionConfig = append(stepDefinitionConfig, &messages.StepDefinitionConfig{
 			Id: strconv.Itoa(i),
 			Pattern: &messages.StepDefinitionPattern{
-				Source: sd.Pattern,
-				Type:   messages.StepDefinitionPatternType_REGULAR_EXPRESSION,
+				Source: expressionSource(sd.Pattern, sd.PatternType),
+				Type:   sd.PatternType,
 			},
 		})
 	}
 
+	parameterTypeConfig := []*messages.ParameterTypeConfig{
+		{
+			Name:               quotedStringParameterTypeName,
+			RegularExpressions: []string{quotedStringRegexp},
+		},
+	}
+
+	for _, pt := range s.parameterTypes {
+		parameterTypeConfig = append(parameterTypeConfig, pt.config())
+	}
+
 	supportCodeConfig := messages.SupportCodeConfig{
-		StepDefinitionConfigs: stepDefinitionConfig,
+		BeforeTestCaseHookDefinitionConfigs: hookConfigs(s.beforeHooks),
+		AfterTestCaseHookDefinitionConfigs:  append(hookConfigs(s.afterHooks), cleanupHookConfig),
+		StepDefinitionConfigs:               stepDefinitionConfig,
+		ParameterTypeConfigs:                parameterTypeConfig,
 	}
 
 	order := messages.SourcesOrderType_RANDOM
@@ -160,15 +533,15 @@ func (s *suite) Run() int {
 		order = messages.SourcesOrderType_ORDER_OF_DEFINITION
 	}
 
-	var lineFilters []*messages.UriToLinesMapping
-	for filePath, lines := range s.lineFilters {
-		lineFilters = append(lineFilters, &messages.UriToLinesMapping{
+	var uriToLinesMapping []*messages.UriToLinesMapping
+	for filePath, lines := range lineFilters {
+		uriToLinesMapping = append(uriToLinesMapping, &messages.UriToLinesMapping{
 			AbsolutePath: filePath,
 			Lines:        lines,
 		})
 	}
 
-	s.respond(&messages.Envelope{
+	return &messages.Envelope{
 		Message: &messages.Envelope_CommandStart{
 			CommandStart: &messages.CommandStart{
 				BaseDirectory: s.baseDirectory,
@@ -176,15 +549,15 @@ func (s *suite) Run() int {
 					IsFailFast:  s.config.FailFast,
 					IsDryRun:    s.config.DryRun,
 					IsStrict:    s.config.Strict,
-					MaxParallel: s.config.Concurrency,
+					MaxParallel: s.maxParallel(),
 				},
 				SupportCodeConfig: &supportCodeConfig,
 				SourcesConfig: &messages.SourcesConfig{
 					Language:      s.config.Language,
-					AbsolutePaths: s.files,
+					AbsolutePaths: files,
 					Filters: &messages.SourcesFilterConfig{
 						TagExpression:     s.config.TagExpression,
-						UriToLinesMapping: lineFilters,
+						UriToLinesMapping: uriToLinesMapping,
 					},
 					Order: &messages.SourcesOrder{
 						Type: order,
@@ -193,153 +566,685 @@ func (s *suite) Run() int {
 				},
 			},
 		},
-	})
-
-	success := s.listen()
-
-	if success {
-		return 0
-	} else {
-		return 1
 	}
 }
 
-func (s *suite) listen() bool {
+func (s *suite) listen() error {
 	for command := range s.outgoing {
-		s.config.Formatter.ProcessMessage(command)
+		command = s.translate(command)
+
+		switch command.Message.(type) {
+		case *messages.Envelope_TestRunStarted, *messages.Envelope_TestRunFinished:
+			// Retries are reported as part of the first run
+			if !s.retrying {
+				s.process(command)
+			}
+		default:
+			s.process(command)
+		}
 
 		switch x := command.Message.(type) {
 		case *messages.Envelope_TestRunFinished:
-			return x.TestRunFinished.Success
+			return nil
+		case *messages.Envelope_CommandError:
+			return errors.New(x.CommandError)
 		case *messages.Envelope_CommandRunBeforeTestRunHooks:
-			s.respond(&messages.Envelope{
-				Message: &messages.Envelope_CommandActionComplete{
-					CommandActionComplete: &messages.CommandActionComplete{
-						CompletedId: x.CommandRunBeforeTestRunHooks.ActionId,
-						Result: &messages.CommandActionComplete_TestResult{
-							TestResult: &messages.TestResult{
-								Status: messages.TestResult_PASSED,
-							},
-						},
-					},
-				},
-			})
+			if s.retrying {
+				s.complete(x.CommandRunBeforeTestRunHooks.ActionId, &messages.TestResult{Status: messages.TestResult_PASSED})
+				break
+			}
+
+			s.runTestRunHooks(x.CommandRunBeforeTestRunHooks.ActionId, s.beforeAllHooks, true)
 		case *messages.Envelope_CommandRunAfterTestRunHooks:
-			s.respond(&messages.Envelope{
-				Message: &messages.Envelope_CommandActionComplete{
-					CommandActionComplete: &messages.CommandActionComplete{
-						CompletedId: x.CommandRunAfterTestRunHooks.ActionId,
-						Result: &messages.CommandActionComplete_TestResult{
-							TestResult: &messages.TestResult{
-								Status: messages.TestResult_PASSED,
-							},
-						},
-					},
-				},
-			})
+			if s.retrying {
+				s.complete(x.CommandRunAfterTestRunHooks.ActionId, &messages.TestResult{Status: messages.TestResult_PASSED})
+				break
+			}
+
+			// Failed scenarios are retried before after all hooks, so they can still use fixtures
+			if err := s.retry(); err != nil {
+				s.testRunFailed = true
+				s.retryErr = err
+			}
+
+			s.runTestRunHooks(x.CommandRunAfterTestRunHooks.ActionId, append(s.afterAllHooks[:len(s.afterAllHooks):len(s.afterAllHooks)], s.fixtures.teardowns()...), false)
 		case *messages.Envelope_CommandGenerateSnippet:
 			s.respond(&messages.Envelope{
 				Message: &messages.Envelope_CommandActionComplete{
 					CommandActionComplete: &messages.CommandActionComplete{
 						CompletedId: x.CommandGenerateSnippet.ActionId,
 						Result: &messages.CommandActionComplete_Snippet{
-							Snippet: "",
+							Snippet: s.snippet(x.CommandGenerateSnippet),
 						},
 					},
 				},
 			})
+		case *messages.Envelope_GherkinDocument:
+			s.documents[x.GherkinDocument.Uri] = x.GherkinDocument
+		case *messages.Envelope_Pickle:
+			tc := newTestCase(x.Pickle, s.documents[x.Pickle.Uri])
+			tc.process = s.process
+			tc.fixtures = &s.fixtures
+			tc.beforeHooks = matchingHooks(s.beforeHooks, x.Pickle)
+			s.testCases.Store(x.Pickle.Id, tc)
+		case *messages.Envelope_PickleRejected:
+			s.testCases.Delete(x.PickleRejected.PickleId)
 		case *messages.Envelope_CommandInitializeTestCase:
-			go s.initializeTestCase(x.CommandInitializeTestCase)
+			s.schedule(func() { s.initializeTestCase(x.CommandInitializeTestCase) })
+		case *messages.Envelope_CommandRunBeforeTestCaseHook:
+			s.schedule(func() {
+				s.runHook(x.CommandRunBeforeTestCaseHook.ActionId, x.CommandRunBeforeTestCaseHook.PickleId, s.beforeHooks, x.CommandRunBeforeTestCaseHook.TestCaseHookDefinitionId)
+			})
+		case *messages.Envelope_CommandRunAfterTestCaseHook:
+			if x.CommandRunAfterTestCaseHook.TestCaseHookDefinitionId == cleanupHookConfig.Id {
+				s.schedule(func() { s.runCleanups(x.CommandRunAfterTestCaseHook.ActionId, x.CommandRunAfterTestCaseHook.PickleId) })
+				break
+			}
+
+			s.schedule(func() {
+				s.runHook(x.CommandRunAfterTestCaseHook.ActionId, x.CommandRunAfterTestCaseHook.PickleId, s.afterHooks, x.CommandRunAfterTestCaseHook.TestCaseHookDefinitionId)
+			})
+		case *messages.Envelope_TestStepStarted:
+			if tc := s.testCase(x.TestStepStarted.PickleId); tc != nil {
+				tc.stepIndex = int(x.TestStepStarted.Index)
+				tc.inStep = true
+			}
+		case *messages.Envelope_TestHookStarted:
+			if tc := s.testCase(x.TestHookStarted.PickleId); tc != nil {
+				tc.inStep = false
+			}
+		case *messages.Envelope_TestStepFinished:
+			if tc := s.testCase(x.TestStepFinished.PickleId); tc != nil {
+				updateResult(tc.result, x.TestStepFinished.TestResult)
+			}
+		case *messages.Envelope_TestHookFinished:
+			if tc := s.testCase(x.TestHookFinished.PickleId); tc != nil {
+				updateResult(tc.result, x.TestHookFinished.TestResult)
+			}
 		case *messages.Envelope_TestCaseFinished:
+			retry := false
+
+			if tc := s.testCase(x.TestCaseFinished.PickleId); tc != nil {
+				tc.releaseLocks()
+
+				retries, _ := retryCount(tc.pickle, s.config.Retry)
+				if s.tests != nil {
+					retries = 0
+				}
+				retry = s.attempts.record(tc.pickle, x.TestCaseFinished.TestResult, retries, s.config.Strict)
+			}
 			s.testCases.Delete(x.TestCaseFinished.PickleId)
+
+			// cucumber-engine only skips scenarios which have not started yet
+			if s.config.FailFast && !retry && causesFailure(x.TestCaseFinished.TestResult, s.config.Strict) {
+				s.cancel()
+			}
 		case *messages.Envelope_CommandRunTestStep:
-			go s.runTestStep(x.CommandRunTestStep)
+			s.schedule(func() { s.runTestStep(x.CommandRunTestStep) })
 		}
 	}
 
-	return false
+	return errors.New("cucumber-engine stopped before the run finished")
 }
 
-func (s *suite) respond(m *messages.Envelope) {
-	s.incoming <- m
+// Failed scenarios are run again by new cucumber-engine runs filtered to their lines,
+// until they pass or run out of retries. Runs are sequential, so the suite
+// just swaps channels and skips test run hooks while retrying.
+func (s *suite) retry() error {
+	if s.aborted || s.ctx.Err() != nil {
+		return nil
+	}
+
+	incoming, outgoing := s.incoming, s.outgoing
+	defer func() {
+		s.incoming, s.outgoing = incoming, outgoing
+		s.retrying = false
+	}()
+
+	for {
+		lineFilters := s.attempts.due()
+		if len(lineFilters) == 0 {
+			return nil
+		}
+
+		var files []string
+		for file := range lineFilters {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		s.retried = true
+		s.retrying = true
+		s.incoming, s.outgoing = runner.NewRunner().GetCommandChannels()
+		s.respond(s.startCommand(files, lineFilters))
+
+		if err := s.listen(); err != nil {
+			return fmt.Errorf("retry failed: %s", err)
+		}
+	}
 }
 
-func (s *suite) initializeTestCase(command *messages.CommandInitializeTestCase) {
-	testResult := messages.TestResult{
-		Status: messages.TestResult_PASSED,
+// Attachments are processed from step goroutines,
+// so formatters are guarded to receive one message at a time
+func (s *suite) process(m *messages.Envelope) {
+	s.formatterLock.Lock()
+	defer s.formatterLock.Unlock()
+
+	s.config.Formatter.ProcessMessage(m)
+	s.collector.ProcessMessage(m)
+
+	if s.tests != nil {
+		s.tests.ProcessMessage(m)
 	}
+}
 
-	tc := &testCase{}
-	s.testCases.Store(command.Pickle.Id, tc)
+func (s *suite) schedule(fn func()) {
+	s.work <- fn
+}
 
-	err := s.testCaseInitializer(tc)
-	if err != nil {
-		testResult.Status = messages.TestResult_FAILED
+// Responses of a stopped run are dropped
+func (s *suite) respond(m *messages.Envelope) {
+	select {
+	case s.incoming <- m:
+	case <-s.stopped:
 	}
+}
 
+func (s *suite) complete(actionId string, testResult *messages.TestResult) {
 	s.respond(&messages.Envelope{
 		Message: &messages.Envelope_CommandActionComplete{
 			CommandActionComplete: &messages.CommandActionComplete{
-				CompletedId: command.ActionId,
+				CompletedId: actionId,
 				Result: &messages.CommandActionComplete_TestResult{
-					TestResult: &testResult,
+					TestResult: testResult,
 				},
 			},
 		},
 	})
 }
 
-func (s *suite) runTestStep(command *messages.CommandRunTestStep) {
+func (s *suite) testCase(pickleId string) *testCase {
+	tc, ok := s.testCases.Load(pickleId)
+	if !ok {
+		return nil
+	}
+
+	return tc.(*testCase)
+}
+
+// cucumber-engine reports hooks as test steps, so they are translated to
+// hook messages and step indexes are mapped to pickle steps for formatters
+func (s *suite) translate(command *messages.Envelope) *messages.Envelope {
+	switch x := command.Message.(type) {
+	case *messages.Envelope_TestRunFinished:
+		success := x.TestRunFinished.Success && !s.testRunFailed && !s.isInterrupted()
+
+		// cucumber-engine only knows about the first attempt of retried scenarios
+		if s.retried {
+			success = !s.testRunFailed && !s.isInterrupted() && s.attempts.success(s.config.Strict, s.config.StrictFlaky)
+		}
+
+		if success != x.TestRunFinished.Success {
+			return &messages.Envelope{
+				Message: &messages.Envelope_TestRunFinished{
+					TestRunFinished: &messages.TestRunFinished{Success: success},
+				},
+			}
+		}
+	case *messages.Envelope_TestStepStarted:
+		tc := s.testCase(x.TestStepStarted.PickleId)
+		if tc == nil {
+			return command
+		}
+
+		index, ok := tc.pickleStepIndex(int(x.TestStepStarted.Index))
+		if !ok {
+			return &messages.Envelope{
+				Message: &messages.Envelope_TestHookStarted{
+					TestHookStarted: &messages.TestHookStarted{
+						PickleId:  x.TestStepStarted.PickleId,
+						Timestamp: x.TestStepStarted.Timestamp,
+					},
+				},
+			}
+		}
+
+		return &messages.Envelope{
+			Message: &messages.Envelope_TestStepStarted{
+				TestStepStarted: &messages.TestStepStarted{
+					PickleId:  x.TestStepStarted.PickleId,
+					Index:     uint32(index),
+					Timestamp: x.TestStepStarted.Timestamp,
+				},
+			},
+		}
+	case *messages.Envelope_TestStepFinished:
+		tc := s.testCase(x.TestStepFinished.PickleId)
+		if tc == nil {
+			return command
+		}
+
+		index, ok := tc.pickleStepIndex(int(x.TestStepFinished.Index))
+		if !ok {
+			return &messages.Envelope{
+				Message: &messages.Envelope_TestHookFinished{
+					TestHookFinished: &messages.TestHookFinished{
+						PickleId:   x.TestStepFinished.PickleId,
+						TestResult: x.TestStepFinished.TestResult,
+						Timestamp:  x.TestStepFinished.Timestamp,
+					},
+				},
+			}
+		}
+
+		return &messages.Envelope{
+			Message: &messages.Envelope_TestStepFinished{
+				TestStepFinished: &messages.TestStepFinished{
+					PickleId:   x.TestStepFinished.PickleId,
+					Index:      uint32(index),
+					TestResult: x.TestStepFinished.TestResult,
+					Timestamp:  x.TestStepFinished.Timestamp,
+				},
+			},
+		}
+	}
+
+	return command
+}
+
+func skippedResult() *messages.TestResult {
+	return &messages.TestResult{
+		Status: messages.TestResult_SKIPPED,
+	}
+}
+
+// Runs step or hook handler reporting panics, ErrPending and skips
+func execute(name string, fn func() error) *messages.TestResult {
 	now := time.Now()
-	err := s.callStepHandler(command)
-	duration := time.Since(now)
 
-	testResult := messages.TestResult{
+	return newTestResult(call(name, fn), now)
+}
+
+// Runs handler in its own goroutine, so it can be stopped
+// with runtime.Goexit by TestCase.FailNow
+func call(name string, fn func() error) error {
+	done := make(chan error, 1)
+
+	go func() {
+		returned := false
+
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("%s panicked: %+v\n%s", name, r, string(debug.Stack()))
+			} else if !returned {
+				done <- errFailNow
+			}
+		}()
+
+		err := fn()
+		returned = true
+		done <- err
+	}()
+
+	return <-done
+}
+
+func newTestResult(err error, started time.Time) *messages.TestResult {
+	testResult := &messages.TestResult{
 		Status:              messages.TestResult_PASSED,
-		DurationNanoseconds: uint64(duration.Nanoseconds()),
+		DurationNanoseconds: uint64(time.Since(started).Nanoseconds()),
 	}
 
 	if err == ErrPending {
 		testResult.Status = messages.TestResult_PENDING
+	} else if err == ErrSkipped {
+		testResult.Status = messages.TestResult_SKIPPED
+	} else if skip, ok := err.(*skipError); ok {
+		testResult.Status = messages.TestResult_SKIPPED
+		testResult.Message = skip.reason
 	} else if err != nil {
 		testResult.Status = messages.TestResult_FAILED
 		testResult.Message = err.Error()
 	}
 
-	s.respond(&messages.Envelope{
-		Message: &messages.Envelope_CommandActionComplete{
-			CommandActionComplete: &messages.CommandActionComplete{
-				CompletedId: command.ActionId,
-				Result: &messages.CommandActionComplete_TestResult{
-					TestResult: &testResult,
+	return testResult
+}
+
+// Test run hooks are run while cucumber-engine awaits the response,
+// so they are reported to formatters as hook messages without pickle.
+// cucumber-engine ignores the result, failing before all hooks abort the run.
+func (s *suite) runTestRunHooks(actionId string, hooks []testRunHookDefinition, abortOnFailure bool) {
+	testResult := &messages.TestResult{
+		Status: messages.TestResult_PASSED,
+	}
+
+	if s.config.DryRun {
+		hooks = nil
+	}
+
+	for _, hd := range hooks {
+		s.process(&messages.Envelope{
+			Message: &messages.Envelope_TestHookStarted{
+				TestHookStarted: &messages.TestHookStarted{},
+			},
+		})
+
+		hookResult := hd.run()
+		updateResult(testResult, hookResult)
+
+		s.process(&messages.Envelope{
+			Message: &messages.Envelope_TestHookFinished{
+				TestHookFinished: &messages.TestHookFinished{
+					TestResult: hookResult,
 				},
 			},
-		},
+		})
+
+		if hookResult.Status == messages.TestResult_FAILED {
+			s.testRunFailed = true
+
+			if abortOnFailure {
+				s.aborted = true
+				break
+			}
+		}
+	}
+
+	s.complete(actionId, testResult)
+}
+
+func (s *suite) initializeTestCase(command *messages.CommandInitializeTestCase) {
+	if s.aborted {
+		s.complete(command.ActionId, skippedResult())
+		return
+	}
+
+	tc := s.testCase(command.Pickle.Id)
+
+	// Scenarios filtered out by go test -run are skipped with their hooks
+	if s.tests != nil && !s.tests.selected(tc.pickle.Id, s.ctx.Done()) {
+		tc.skipped = true
+		s.complete(command.ActionId, skippedResult())
+		return
+	}
+
+	// cucumber-engine awaits initialization, so scenario starts once it holds its locks
+	tc.holdLocks(s.locks.lock(tc.pickle))
+
+	// Scenarios which have not started before the run was stopped are skipped with their hooks
+	if s.ctx.Err() != nil {
+		tc.skipped = true
+		s.complete(command.ActionId, skippedResult())
+		return
+	}
+
+	testResult := tc.execute("test case initializer", func() error {
+		if _, err := retryCount(tc.pickle, s.config.Retry); err != nil {
+			return err
+		}
+
+		if s.world != nil {
+			world, err := s.world.new()
+			if err != nil {
+				return err
+			}
+
+			tc.world = world
+		}
+
+		return s.testCaseInitializer(tc)
+	})
+
+	// cucumber-engine ignores the result of initialization,
+	// so the first hook or step of the scenario reports its failure
+	if testResult.Status == messages.TestResult_FAILED {
+		tc.initFailure = testResult
+	}
+
+	s.complete(command.ActionId, testResult)
+}
+
+func (s *suite) runHook(actionId, pickleId string, hooks []hookDefinition, hookDefinitionId string) {
+	tc := s.testCase(pickleId)
+
+	if s.aborted || tc.skipped {
+		s.complete(actionId, skippedResult())
+		return
+	}
+
+	if testResult := tc.takeInitFailure(); testResult != nil {
+		s.complete(actionId, testResult)
+		return
+	}
+
+	testResult := tc.execute("hook", func() error {
+		i, err := strconv.Atoi(hookDefinitionId)
+		if err != nil {
+			return err
+		}
+
+		return hooks[i].Handler(tc, newScenarioResult(tc.result))
 	})
+
+	s.complete(actionId, keepSkipped(tc, testResult))
+}
+
+// Cleanups are run in reverse order even if the scenario was aborted,
+// all failures are reported together
+func (s *suite) runCleanups(actionId, pickleId string) {
+	testResult := &messages.TestResult{
+		Status: messages.TestResult_PASSED,
+	}
+
+	tc := s.testCase(pickleId)
+	for _, fn := range tc.popCleanups() {
+		mergeStepResult(testResult, tc.execute("cleanup", fn))
+	}
+
+	s.complete(actionId, keepSkipped(tc, testResult))
+}
+
+// cucumber-engine lets passed hooks override skipped scenario status,
+// so hooks of skipped scenarios are reported as skipped unless they fail
+func keepSkipped(tc *testCase, testResult *messages.TestResult) *messages.TestResult {
+	if testResult.Status == messages.TestResult_PASSED && tc.result.Status == messages.TestResult_SKIPPED {
+		testResult.Status = messages.TestResult_SKIPPED
+	}
+
+	return testResult
+}
+
+// Step hooks are run together with the step, so their failures are reported as step failures
+func (s *suite) runTestStep(command *messages.CommandRunTestStep) {
+	tc := s.testCase(command.PickleId)
+
+	if s.aborted || tc.skipped || s.ctx.Err() != nil {
+		s.complete(command.ActionId, skippedResult())
+		return
+	}
+
+	if testResult := tc.takeInitFailure(); testResult != nil {
+		s.complete(command.ActionId, testResult)
+		return
+	}
+	step := tc.Step()
+
+	testResult := &messages.TestResult{
+		Status: messages.TestResult_PASSED,
+	}
+
+	for _, hd := range s.beforeStepHooks {
+		if !hd.matches(tc.pickle) {
+			continue
+		}
+
+		mergeStepResult(testResult, tc.execute("before step hook", func() error {
+			return hd.Handler(tc, step, StepResult{})
+		}))
+
+		if testResult.Status == messages.TestResult_FAILED {
+			break
+		}
+	}
+
+	if testResult.Status == messages.TestResult_PASSED {
+		mergeStepResult(testResult, s.runStepHandler(tc, command))
+	}
+
+	for _, hd := range s.afterStepHooks {
+		if !hd.matches(tc.pickle) {
+			continue
+		}
+
+		stepResult := newStepResult(testResult)
+		mergeStepResult(testResult, tc.execute("after step hook", func() error {
+			return hd.Handler(tc, step, stepResult)
+		}))
+	}
+
+	s.complete(command.ActionId, testResult)
+}
+
+// Unlike test case result, step result keeps messages of all failures
+func mergeStepResult(result *messages.TestResult, hookResult *messages.TestResult) {
+	message := result.Message
+
+	updateResult(result, hookResult)
+
+	if message != "" && hookResult.Message != "" {
+		result.Message = message + "\n" + hookResult.Message
+	}
 }
 
-func (s *suite) callStepHandler(command *messages.CommandRunTestStep) (err error) {
+// Step handler is run in its own goroutine, so the step is reported as failed
+// when its context is done even if the handler does not return
+func (s *suite) runStepHandler(tc *testCase, command *messages.CommandRunTestStep) *messages.TestResult {
+	now := time.Now()
+
 	i, err := strconv.Atoi(command.StepDefinitionId)
 	if err != nil {
-		return err
+		return failedResult(err.Error(), now)
 	}
 
 	stepDefinition := s.stepDefinitions[i]
 
-	var captures []string
+	timeout, err := s.stepTimeout(stepDefinition, tc.pickle)
+	if err != nil {
+		return failedResult(err.Error(), now)
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(s.ctx)
+	}
+	defer cancel()
+
+	args, err := s.stepArguments(command.PatternMatches)
+	if err != nil {
+		return failedResult(err.Error(), now)
+	}
+
+	var argument interface{}
+	if step := tc.currentStep(); step != nil {
+		argument = newStepArgument(tc.pickle.Uri, step.Argument)
+	}
+
+	sc := &stepTestCase{testCase: tc}
+	done := make(chan error, 1)
+	go func() {
+		done <- call("step handler", func() error {
+			return stepDefinition.Handler.call(ctx, sc, args, argument)
+		})
+	}()
+
+	var testResult *messages.TestResult
+	select {
+	case err := <-done:
+		testResult = newTestResult(tc.check(err), now)
+		if testResult.Status != messages.TestResult_FAILED {
+			return testResult
+		}
+	case <-ctx.Done():
+		sc.abandon()
+	}
+
+	// handler failing because of the context is reported as timed out or cancelled too
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return failedResult(fmt.Sprintf("step timed out after %s", timeout), now)
+	case context.Canceled:
+		if s.isInterrupted() {
+			return failedResult("step interrupted", now)
+		}
+
+		return failedResult("step cancelled", now)
+	}
+
+	return testResult
+}
+
+func (s *suite) stepTimeout(sd stepDefinition, pickle *messages.Pickle) (time.Duration, error) {
+	value, ok := tagArgument(pickle, "timeout")
+	if !ok {
+		if sd.Timeout > 0 {
+			return sd.Timeout, nil
+		}
+
+		return s.config.StepTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid @timeout tag: %s", err)
+	}
+
+	return timeout, nil
+}
+
+func failedResult(message string, started time.Time) *messages.TestResult {
+	return &messages.TestResult{
+		Status:              messages.TestResult_FAILED,
+		Message:             message,
+		DurationNanoseconds: uint64(time.Since(started).Nanoseconds()),
+	}
+}
+
+func (s *suite) stepArguments(patternMatches []*messages.PatternMatch) ([]interface{}, error) {
+	var args []interface{}
+
+	for _, patternMatch := range patternMatches {
+		if patternMatch.ParameterTypeName == quotedStringParameterTypeName {
+			args = append(args, unquote(patternMatch.Captures[0]))
+			continue
+		}
+
+		if pt, ok := s.parameterType(patternMatch.ParameterTypeName); ok {
+			value, err := pt.transform(patternMatch.Captures)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, value)
+			continue
+		}
 
-	for _, patternMatch := range command.PatternMatches {
 		// TODO: when would we get multiple captures within a single pattern match?
-		captures = append(captures, patternMatch.Captures...)
+		for _, capture := range patternMatch.Captures {
+			args = append(args, capture)
+		}
 	}
 
-	testCase, _ := s.testCases.Load(command.PickleId)
+	return args, nil
+}
 
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("step handler panicked: %+v\n%s", r, string(debug.Stack()))
+func (s *suite) parameterType(name string) (parameterType, bool) {
+	for _, pt := range s.parameterTypes {
+		if pt.Name == name {
+			return pt, true
 		}
-	}()
+	}
 
-	return stepDefinition.Handler(testCase.(TestCase), captures...)
+	return parameterType{}, false
 }
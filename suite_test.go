@@ -1,8 +1,10 @@
 package cucumber
 
 import (
+	"runtime"
 	"testing"
 
+	messages "github.com/cucumber/cucumber-messages-go/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,16 +15,20 @@ func TestNewSuite(t *testing.T) {
 	assert.Equal(t, "en", s.config.Language)
 	assert.NotEqual(t, 0, s.config.Seed)
 	assert.Equal(t, []string{"features/"}, s.config.Paths)
+	assert.Equal(t, uint64(0), s.config.Concurrency)
+	assert.Equal(t, uint64(runtime.GOMAXPROCS(0)), s.config.ScenarioConcurrency)
 
 	s, err = NewSuite(Config{
 		Seed:        uint64(321),
 		Concurrency: uint64(10),
 		Strict:      true,
-	}, "--seed", "123", "-c", "1", "--fast", "--dry", "features/concat.feature")
+	}, "--seed", "123", "-c", "1", "--scenario-concurrency", "4", "--fast", "--dry", "features/concat.feature")
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123), s.config.Seed)
 	assert.Equal(t, []string{"features/concat.feature"}, s.config.Paths)
 	assert.Equal(t, uint64(1), s.config.Concurrency)
+	assert.Equal(t, uint64(4), s.config.ScenarioConcurrency)
+	assert.Equal(t, uint64(1), s.maxParallel())
 	assert.True(t, s.config.FailFast)
 	assert.True(t, s.config.Strict)
 	assert.True(t, s.config.DryRun)
@@ -37,3 +43,11 @@ func TestNewSuite(t *testing.T) {
 		assert.Equal(t, "flag provided but not defined: -fasst", err.Error())
 	}
 }
+
+func TestRespondAfterStop(t *testing.T) {
+	s := &suite{incoming: make(chan *messages.Envelope), stopped: make(chan struct{})}
+	close(s.stopped)
+
+	// Nobody reads responses of a stopped run, so they must not block workers
+	s.respond(&messages.Envelope{})
+}
@@ -0,0 +1,42 @@
+package cucumber
+
+import (
+	"strings"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
+// Returns argument of a tag like @name(argument), scenario tags
+// take precedence over feature tags
+func tagArgument(pickle *messages.Pickle, name string) (string, bool) {
+	arguments := tagArguments(pickle, name)
+	if len(arguments) == 0 {
+		return "", false
+	}
+
+	return arguments[len(arguments)-1], true
+}
+
+// Returns arguments of all tags like @name(argument) in order of definition
+func tagArguments(pickle *messages.Pickle, name string) []string {
+	prefix := "@" + name + "("
+
+	var arguments []string
+	for _, tag := range pickle.Tags {
+		if strings.HasPrefix(tag.Name, prefix) && strings.HasSuffix(tag.Name, ")") {
+			arguments = append(arguments, tag.Name[len(prefix):len(tag.Name)-1])
+		}
+	}
+
+	return arguments
+}
+
+func hasTag(pickle *messages.Pickle, name string) bool {
+	for _, tag := range pickle.Tags {
+		if tag.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
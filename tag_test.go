@@ -0,0 +1,44 @@
+package cucumber
+
+import (
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagArgument(t *testing.T) {
+	pickle := &messages.Pickle{
+		Tags: []*messages.Pickle_PickleTag{
+			{Name: "@timeout(1s)"},
+			{Name: "@db"},
+			{Name: "@timeout(5s)"},
+			{Name: "@timeouts"},
+		},
+	}
+
+	argument, ok := tagArgument(pickle, "timeout")
+	assert.True(t, ok)
+	assert.Equal(t, "5s", argument)
+
+	_, ok = tagArgument(pickle, "db")
+	assert.False(t, ok)
+
+	_, ok = tagArgument(pickle, "retry")
+	assert.False(t, ok)
+}
+
+func TestTagArguments(t *testing.T) {
+	pickle := &messages.Pickle{
+		Tags: []*messages.Pickle_PickleTag{
+			{Name: "@exclusive(db)"},
+			{Name: "@serial"},
+			{Name: "@exclusive(port)"},
+		},
+	}
+
+	assert.Equal(t, []string{"db", "port"}, tagArguments(pickle, "exclusive"))
+	assert.Empty(t, tagArguments(pickle, "serial"))
+	assert.True(t, hasTag(pickle, "@serial"))
+	assert.False(t, hasTag(pickle, "@exclusive"))
+}
@@ -1,16 +1,437 @@
 package cucumber
 
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+)
+
 type TestCase interface {
 	Set(key string, value interface{})
 	Get(key string) interface{}
+
+	// Pickle id assigned by cucumber-engine, unique within the run
+	PickleID() string
+
+	// Scenario name, outline parameters are replaced with example values
+	ScenarioName() string
+
+	FeatureName() string
+
+	// Feature file the scenario comes from
+	URI() string
+
+	// Line of the scenario, or of the example row for scenario outlines
+	Line() int
+
+	// Tags of the scenario including inherited feature and examples tags
+	Tags() []string
+
+	// Example row values keyed by the table header,
+	// nil unless the scenario comes from a scenario outline
+	Example() map[string]string
+
+	// Step being executed
+	Step() Step
+
+	// World created for the scenario by the suite world factory,
+	// nil unless the suite defines a world
+	World() interface{}
+
+	// Registers function to run when the scenario finishes,
+	// cleanups are run in reverse order of registration
+	Cleanup(fn func() error)
+
+	// Sends data of given media type to formatters,
+	// attachment is located at the current step or hook
+	Attach(data []byte, mediaType string)
+
+	// Sends formatted text/plain attachment to formatters
+	Log(format string, args ...interface{})
+
+	// Records failure and continues, the current step or hook
+	// fails when it returns with all recorded failures
+	Errorf(format string, args ...interface{})
+
+	// Stops the current step or hook, which fails with recorded failures.
+	// Together with Errorf it makes TestCase usable with testify assert and require.
+	FailNow()
+
+	// Returns suite fixture, initializing it on first use
+	Fixture(name string) (interface{}, error)
+}
+
+// Step being executed, passed to step hooks
+type Step struct {
+	Text  string
+	Index int
+}
+
+type testCase struct {
+	values      map[string]interface{}
+	pickle      *messages.Pickle
+	featureName string
+	example     map[string]string
+	world       interface{}
+	cleanups    []func() error
+	failures    []string
+	mu          sync.Mutex
+	beforeHooks int
+	stepIndex   int
+	inStep      bool
+	process     func(*messages.Envelope)
+	fixtures    *fixtures
+	unlock      func()
+	released    bool
+	skipped     bool
+	initFailure *messages.TestResult
+	result      *messages.TestResult
+}
+
+func newTestCase(pickle *messages.Pickle, document *messages.GherkinDocument) *testCase {
+	tc := &testCase{
+		values: map[string]interface{}{},
+		pickle: pickle,
+		result: &messages.TestResult{
+			Status: messages.TestResult_PASSED,
+		},
+	}
+
+	if document != nil && document.Feature != nil {
+		tc.featureName = document.Feature.Name
+		tc.example = exampleRow(document.Feature, pickle)
+	}
+
+	return tc
+}
+
+// Values are guarded, a timed out step handler may still be running
+// while hooks and later steps of the scenario use them
+func (tc *testCase) Set(key string, value interface{}) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.values[key] = value
+}
+
+func (tc *testCase) Get(key string) interface{} {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	return tc.values[key]
+}
+
+func (tc *testCase) PickleID() string {
+	return tc.pickle.Id
+}
+
+func (tc *testCase) ScenarioName() string {
+	return tc.pickle.Name
+}
+
+func (tc *testCase) FeatureName() string {
+	return tc.featureName
+}
+
+func (tc *testCase) URI() string {
+	return tc.pickle.Uri
+}
+
+func (tc *testCase) Line() int {
+	if len(tc.pickle.Locations) == 0 {
+		return 0
+	}
+
+	return int(tc.pickle.Locations[len(tc.pickle.Locations)-1].Line)
+}
+
+func (tc *testCase) Tags() []string {
+	var tags []string
+	for _, tag := range tc.pickle.Tags {
+		tags = append(tags, tag.Name)
+	}
+
+	return tags
+}
+
+func (tc *testCase) Example() map[string]string {
+	return tc.example
+}
+
+func (tc *testCase) World() interface{} {
+	return tc.world
+}
+
+func (tc *testCase) Cleanup(fn func() error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.cleanups = append(tc.cleanups, fn)
+}
+
+// Keeps locks taken for the scenario, they are released at once
+// when the scenario was abandoned while waiting for them
+func (tc *testCase) holdLocks(unlock func()) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.released {
+		unlock()
+		return
+	}
+
+	tc.unlock = unlock
+}
+
+// Releases locks of the scenario, safe to call more than once
+func (tc *testCase) releaseLocks() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.released = true
+
+	if tc.unlock != nil {
+		tc.unlock()
+		tc.unlock = nil
+	}
+}
+
+// Test case passed to a step handler, which may keep running after its step
+// is reported when it ignores the context. Values, failures and cleanups it
+// records after that are ignored, so they do not leak into later steps and hooks.
+type stepTestCase struct {
+	*testCase
+	finished bool
 }
 
-type testCase map[string]interface{}
+func (sc *stepTestCase) Set(key string, value interface{}) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
 
-func (tc testCase) Set(key string, value interface{}) {
-	tc[key] = value
+	if !sc.finished {
+		sc.values[key] = value
+	}
 }
 
-func (tc testCase) Get(key string) interface{} {
-	return tc[key]
+func (sc *stepTestCase) Errorf(format string, args ...interface{}) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if !sc.finished {
+		sc.failures = append(sc.failures, fmt.Sprintf(format, args...))
+	}
+}
+
+func (sc *stepTestCase) Cleanup(fn func() error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if !sc.finished {
+		sc.cleanups = append(sc.cleanups, fn)
+	}
+}
+
+// Stops recording calls of the handler and drops failures it recorded so far
+func (sc *stepTestCase) abandon() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.finished = true
+	sc.failures = nil
+}
+
+// Returns failed initialization result once, nil if initialization passed
+func (tc *testCase) takeInitFailure() *messages.TestResult {
+	testResult := tc.initFailure
+	tc.initFailure = nil
+
+	return testResult
+}
+
+// Returns registered cleanups in the order they should run
+func (tc *testCase) popCleanups() []func() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	var cleanups []func() error
+	for i := len(tc.cleanups) - 1; i >= 0; i-- {
+		cleanups = append(cleanups, tc.cleanups[i])
+	}
+	tc.cleanups = nil
+
+	return cleanups
+}
+
+func (tc *testCase) Attach(data []byte, mediaType string) {
+	if tc.process == nil {
+		return
+	}
+
+	attachment := &messages.Attachment{
+		Source: &messages.SourceReference{
+			Uri:      tc.pickle.Uri,
+			Location: tc.location(),
+		},
+		Media: &messages.Media{
+			ContentType: mediaType,
+		},
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		attachment.Media.Encoding = messages.Media_UTF8
+		attachment.Data = string(data)
+	} else {
+		attachment.Media.Encoding = messages.Media_BASE64
+		attachment.Data = base64.StdEncoding.EncodeToString(data)
+	}
+
+	tc.process(&messages.Envelope{
+		Message: &messages.Envelope_Attachment{
+			Attachment: attachment,
+		},
+	})
+}
+
+func (tc *testCase) Log(format string, args ...interface{}) {
+	tc.Attach([]byte(fmt.Sprintf(format, args...)), "text/plain")
+}
+
+func (tc *testCase) Errorf(format string, args ...interface{}) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.failures = append(tc.failures, fmt.Sprintf(format, args...))
+}
+
+func (tc *testCase) Fixture(name string) (interface{}, error) {
+	if tc.fixtures == nil {
+		return nil, fmt.Errorf("fixture %q is not defined", name)
+	}
+
+	return tc.fixtures.get(name)
+}
+
+// Must be called from the goroutine running the step or hook,
+// like testing.T.FailNow it stops the goroutine
+func (tc *testCase) FailNow() {
+	runtime.Goexit()
+}
+
+// Runs step or hook handler, failures recorded with Errorf fail it
+func (tc *testCase) execute(name string, fn func() error) *messages.TestResult {
+	now := time.Now()
+
+	return newTestResult(tc.check(call(name, fn)), now)
+}
+
+// Combines failures recorded with Errorf and the returned error,
+// recorded failures are cleared for the next step or hook
+func (tc *testCase) check(err error) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if len(tc.failures) == 0 {
+		return err
+	}
+
+	failures := tc.failures
+	tc.failures = nil
+
+	if err != nil && err != errFailNow {
+		failures = append(failures, err.Error())
+	}
+
+	return errors.New(strings.Join(failures, "\n"))
+}
+
+// Attachment source is the current step, or the scenario outside of steps
+func (tc *testCase) location() *messages.Location {
+	if step := tc.currentStep(); step != nil && tc.inStep {
+		return step.Locations[len(step.Locations)-1]
+	}
+
+	if len(tc.pickle.Locations) == 0 {
+		return nil
+	}
+
+	return tc.pickle.Locations[len(tc.pickle.Locations)-1]
+}
+
+func (tc *testCase) currentStep() *messages.Pickle_PickleStep {
+	if tc.pickle == nil || tc.stepIndex >= len(tc.pickle.Steps) {
+		return nil
+	}
+
+	return tc.pickle.Steps[tc.stepIndex]
+}
+
+func (tc *testCase) Step() Step {
+	step := Step{Index: tc.stepIndex}
+
+	if pickleStep := tc.currentStep(); pickleStep != nil {
+		step.Text = pickleStep.Text
+	}
+
+	return step
+}
+
+// cucumber-engine indexes hooks and steps together,
+// returns false if index belongs to a hook
+func (tc *testCase) pickleStepIndex(index int) (int, bool) {
+	index -= tc.beforeHooks
+
+	if index < 0 || index >= len(tc.pickle.Steps) {
+		return 0, false
+	}
+
+	return index, true
+}
+
+// Pickles of scenario outlines are located at the scenario and the example row
+func exampleRow(feature *messages.GherkinDocument_Feature, pickle *messages.Pickle) map[string]string {
+	if len(pickle.Locations) != 2 {
+		return nil
+	}
+
+	var scenarios []*messages.GherkinDocument_Feature_Scenario
+	for _, child := range feature.Children {
+		if scenario := child.GetScenario(); scenario != nil {
+			scenarios = append(scenarios, scenario)
+		}
+
+		for _, ruleChild := range child.GetRule().GetChildren() {
+			if scenario := ruleChild.GetScenario(); scenario != nil {
+				scenarios = append(scenarios, scenario)
+			}
+		}
+	}
+
+	for _, scenario := range scenarios {
+		if scenario.Location.Line != pickle.Locations[0].Line {
+			continue
+		}
+
+		for _, examples := range scenario.Examples {
+			for _, row := range examples.TableBody {
+				if row.Location.Line != pickle.Locations[1].Line {
+					continue
+				}
+
+				example := map[string]string{}
+				for i, cell := range examples.TableHeader.Cells {
+					example[cell.Value] = row.Cells[i].Value
+				}
+
+				return example
+			}
+		}
+	}
+
+	return nil
 }
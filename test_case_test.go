@@ -0,0 +1,179 @@
+package cucumber
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestCaseMetadata(t *testing.T) {
+	feature := &messages.GherkinDocument_Feature{
+		Name: "Feature",
+		Children: []*messages.GherkinDocument_Feature_FeatureChild{
+			{
+				Value: &messages.GherkinDocument_Feature_FeatureChild_Scenario{
+					Scenario: &messages.GherkinDocument_Feature_Scenario{
+						Location: &messages.Location{Line: 3},
+						Examples: []*messages.GherkinDocument_Feature_Scenario_Examples{
+							{
+								TableHeader: &messages.GherkinDocument_Feature_TableRow{
+									Cells: []*messages.GherkinDocument_Feature_TableRow_TableCell{{Value: "name"}, {Value: "count"}},
+								},
+								TableBody: []*messages.GherkinDocument_Feature_TableRow{
+									{
+										Location: &messages.Location{Line: 8},
+										Cells:    []*messages.GherkinDocument_Feature_TableRow_TableCell{{Value: "foo"}, {Value: "1"}},
+									},
+									{
+										Location: &messages.Location{Line: 9},
+										Cells:    []*messages.GherkinDocument_Feature_TableRow_TableCell{{Value: "bar"}, {Value: "2"}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	pickle := &messages.Pickle{
+		Id:        "id",
+		Uri:       "features/foo.feature",
+		Name:      "outline bar",
+		Locations: []*messages.Location{{Line: 3}, {Line: 9}},
+		Tags:      []*messages.Pickle_PickleTag{{Name: "@foo"}, {Name: "@bar"}},
+		Steps:     []*messages.Pickle_PickleStep{{Text: "a step"}},
+	}
+
+	tc := newTestCase(pickle, &messages.GherkinDocument{Feature: feature})
+	assert.Equal(t, "id", tc.PickleID())
+	assert.Equal(t, "outline bar", tc.ScenarioName())
+	assert.Equal(t, "Feature", tc.FeatureName())
+	assert.Equal(t, "features/foo.feature", tc.URI())
+	assert.Equal(t, 9, tc.Line())
+	assert.Equal(t, []string{"@foo", "@bar"}, tc.Tags())
+	assert.Equal(t, map[string]string{"name": "bar", "count": "2"}, tc.Example())
+	assert.Equal(t, Step{Text: "a step", Index: 0}, tc.Step())
+
+	pickle.Locations = pickle.Locations[:1]
+	tc = newTestCase(pickle, &messages.GherkinDocument{Feature: feature})
+	assert.Equal(t, 3, tc.Line())
+	assert.Nil(t, tc.Example())
+}
+
+func TestTestCaseCleanup(t *testing.T) {
+	tc := newTestCase(&messages.Pickle{}, nil)
+
+	var calls []int
+	for i := 0; i < 3; i++ {
+		i := i
+		tc.Cleanup(func() error {
+			calls = append(calls, i)
+			return nil
+		})
+	}
+
+	for _, fn := range tc.popCleanups() {
+		assert.NoError(t, fn())
+	}
+	assert.Equal(t, []int{2, 1, 0}, calls)
+	assert.Empty(t, tc.popCleanups())
+}
+
+func TestTestCaseErrorf(t *testing.T) {
+	tc := newTestCase(&messages.Pickle{}, nil)
+
+	assert.Nil(t, tc.check(nil))
+	assert.Equal(t, ErrPending, tc.check(ErrPending))
+
+	tc.Errorf("expected %d but got %d", 1, 2)
+	tc.Errorf("name is empty")
+
+	err := tc.check(errors.New("request failed"))
+	if assert.Error(t, err) {
+		assert.Equal(t, "expected 1 but got 2\nname is empty\nrequest failed", err.Error())
+	}
+
+	tc.Errorf("status is wrong")
+
+	err = tc.check(nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "status is wrong", err.Error())
+	}
+
+	assert.Nil(t, tc.check(nil))
+}
+
+func TestTestCaseFailNow(t *testing.T) {
+	tc := newTestCase(&messages.Pickle{}, nil)
+
+	var _ require.TestingT = tc
+
+	continued := false
+	testResult := tc.execute("step handler", func() error {
+		tc.Errorf("expected 1 but got 2")
+		tc.FailNow()
+		continued = true
+		return nil
+	})
+	assert.False(t, continued)
+	assert.Equal(t, messages.TestResult_FAILED, testResult.Status)
+	assert.Equal(t, "expected 1 but got 2", testResult.Message)
+
+	testResult = tc.execute("step handler", func() error {
+		tc.FailNow()
+		return nil
+	})
+	assert.Equal(t, messages.TestResult_FAILED, testResult.Status)
+	assert.Equal(t, "stopped by FailNow", testResult.Message)
+}
+
+func TestTestCaseLocks(t *testing.T) {
+	var locks scenarioLocks
+	pickle := &messages.Pickle{Tags: []*messages.Pickle_PickleTag{{Name: "@serial"}}}
+
+	tc := newTestCase(pickle, nil)
+	tc.holdLocks(locks.lock(pickle))
+	tc.releaseLocks()
+	tc.releaseLocks()
+
+	// Scenario abandoned while waiting releases its locks once it gets them
+	abandoned := newTestCase(pickle, nil)
+	abandoned.releaseLocks()
+	abandoned.holdLocks(locks.lock(pickle))
+
+	locked := make(chan struct{})
+	go func() {
+		locks.lock(pickle)()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("locks are still held")
+	}
+}
+
+func TestStepTestCaseAbandon(t *testing.T) {
+	tc := newTestCase(&messages.Pickle{}, nil)
+	sc := &stepTestCase{testCase: tc}
+
+	var _ TestCase = sc
+
+	sc.Set("state", "before")
+	sc.Errorf("recorded before the step timed out")
+	sc.abandon()
+	sc.Set("state", "after")
+	sc.Errorf("recorded after the step timed out")
+	sc.Cleanup(func() error { return nil })
+
+	assert.Equal(t, "before", tc.Get("state"))
+	assert.Nil(t, tc.check(nil))
+	assert.Empty(t, tc.popCleanups())
+}
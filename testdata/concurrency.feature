@@ -0,0 +1,12 @@
+Feature: Concurrency
+  Scenario: first
+    Given a slow step
+
+  Scenario: second
+    Given a slow step
+
+  Scenario: third
+    Given a slow step
+
+  Scenario: fourth
+    Given a slow step
@@ -0,0 +1,7 @@
+Feature: Hooks
+  @db
+  Scenario: tagged
+    Given a step
+
+  Scenario: untagged
+    Given a failing step
@@ -0,0 +1,4 @@
+Feature: Invalid retry
+  @retry(abc)
+  Scenario: invalid retry tag
+    Given a step
@@ -0,0 +1,22 @@
+Feature: Locks
+  @exclusive(db)
+  Scenario: db 1
+    Given a slow step
+
+  @exclusive(db)
+  Scenario: db 2
+    Given a slow step
+
+  @exclusive(db) @exclusive(port)
+  Scenario: db 3
+    Given a slow step
+
+  @serial
+  Scenario: serial
+    Given a slow step
+
+  Scenario: parallel 1
+    Given a slow step
+
+  Scenario: parallel 2
+    Given a slow step
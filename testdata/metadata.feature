@@ -0,0 +1,14 @@
+@metadata
+Feature: Metadata
+
+  @plain
+  Scenario: plain scenario
+    Given a step
+
+  Scenario Outline: outline for <name>
+    Given a step
+
+    @examples
+    Examples:
+      | name | count |
+      | foo  | 1     |
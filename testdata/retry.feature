@@ -0,0 +1,10 @@
+Feature: Retry
+  Scenario: flaky
+    Given a flaky step
+
+  @retry(2)
+  Scenario: broken
+    Given a broken step
+
+  Scenario: passing
+    Given a step
@@ -0,0 +1,12 @@
+Feature: Skip
+  Scenario: skipped by step
+    Given a step
+    And a skipped step
+    And a step
+
+  @gpu
+  Scenario: skipped by hook
+    Given a step
+
+  Scenario: passing
+    Given a step
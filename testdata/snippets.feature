@@ -0,0 +1,9 @@
+Feature: Snippets
+  Scenario: whole cukes
+    Given I have 5 cukes
+
+  Scenario: half cukes
+    Given I have 5.5 cukes
+
+  Scenario: more cukes
+    Given I have 7 cukes
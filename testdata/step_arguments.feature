@@ -0,0 +1,13 @@
+Feature: Step arguments
+  Scenario: doc string
+    Given a doc string
+      """json
+      {"foo": "bar"}
+      """
+    Then content type should be "json"
+
+  Scenario: data table
+    Given a data table
+      | name | age |
+      | John | 42  |
+    Then there should be 2 rows
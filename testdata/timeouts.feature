@@ -0,0 +1,10 @@
+Feature: Timeouts
+  Scenario: step definition timeout
+    Given a slow step
+
+  @timeout(10ms)
+  Scenario: tagged timeout
+    Given a blocking step
+
+  Scenario: global timeout
+    Given a blocking step
@@ -1,8 +1,11 @@
 package cucumber
 
 import (
+	"fmt"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -41,3 +44,27 @@ func findFeatures(filepath string) ([]string, error) {
 
 	return files, nil
 }
+
+// Returns feature files in paths and lines to run by file for paths ending with :line
+func findFeatureFiles(paths []string) ([]string, map[string][]uint64, error) {
+	var files []string
+	lineFilters := map[string][]uint64{}
+
+	for _, path := range paths {
+		line := lineFilterMatcher.FindString(path)
+		if line != "" {
+			path = strings.TrimSuffix(path, line)
+			lineNumber, _ := strconv.ParseUint(line[1:], 10, 0)
+
+			lineFilters[path] = append(lineFilters[path], lineNumber)
+		}
+
+		filesForPath, err := findFeatures(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find features in path: %s", path)
+		}
+		files = append(files, filesForPath...)
+	}
+
+	return files, lineFilters, nil
+}
@@ -0,0 +1,47 @@
+package cucumber
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// World factory is a function returning a pointer to a fresh
+// per-scenario struct, e.g. func() *World
+type worldFactory struct {
+	fn    reflect.Value
+	world reflect.Type
+}
+
+func newWorldFactory(fn interface{}) (*worldFactory, error) {
+	if fn == nil {
+		return nil, errors.New("world factory must not be nil")
+	}
+
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+
+	if t.Kind() != reflect.Func || t.NumIn() != 0 || t.NumOut() != 1 {
+		return nil, fmt.Errorf("world factory must be a function without arguments returning world, got %s", t)
+	}
+
+	world := t.Out(0)
+	if world.Kind() != reflect.Ptr || world.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("world must be a pointer to struct, got %s", world)
+	}
+
+	if v.IsNil() {
+		return nil, errors.New("world factory must not be nil")
+	}
+
+	return &worldFactory{fn: v, world: world}, nil
+}
+
+func (f *worldFactory) new() (interface{}, error) {
+	world := f.fn.Call(nil)[0]
+	if world.IsNil() {
+		return nil, fmt.Errorf("world factory returned nil %s", f.world)
+	}
+
+	return world.Interface(), nil
+}
@@ -0,0 +1,83 @@
+package cucumber
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	messages "github.com/cucumber/cucumber-messages-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWorld struct {
+	Value string
+}
+
+func TestNewWorldFactory(t *testing.T) {
+	f, err := newWorldFactory(func() *testWorld { return &testWorld{Value: "foo"} })
+	assert.NoError(t, err)
+	assert.Equal(t, reflect.TypeOf(&testWorld{}), f.world)
+	world, err := f.new()
+	assert.NoError(t, err)
+	assert.Equal(t, &testWorld{Value: "foo"}, world)
+
+	_, err = newWorldFactory(func() testWorld { return testWorld{} })
+	if assert.Error(t, err) {
+		assert.Equal(t, "world must be a pointer to struct, got cucumber.testWorld", err.Error())
+	}
+
+	_, err = newWorldFactory(func(TestCase) *testWorld { return nil })
+	if assert.Error(t, err) {
+		assert.Equal(t, "world factory must be a function without arguments returning world, got func(cucumber.TestCase) *cucumber.testWorld", err.Error())
+	}
+
+	_, err = newWorldFactory(nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "world factory must not be nil", err.Error())
+	}
+
+	var factory func() *testWorld
+	_, err = newWorldFactory(factory)
+	if assert.Error(t, err) {
+		assert.Equal(t, "world factory must not be nil", err.Error())
+	}
+
+	f, err = newWorldFactory(func() *testWorld { return nil })
+	assert.NoError(t, err)
+	_, err = f.new()
+	if assert.Error(t, err) {
+		assert.Equal(t, "world factory returned nil *cucumber.testWorld", err.Error())
+	}
+}
+
+func TestStepHandlerWorld(t *testing.T) {
+	world := reflect.TypeOf(&testWorld{})
+
+	_, err := newStepHandler(func(*testWorld, int) error { return nil }, 1, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler must accept TestCase as the first argument", err.Error())
+	}
+
+	_, err = newStepHandler(func(*struct{}, int) error { return nil }, 1, world)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler must accept TestCase or world *cucumber.testWorld as the first argument", err.Error())
+	}
+
+	h, err := newStepHandler(func(w *testWorld, tc TestCase, value string) error {
+		w.Value = value + tc.PickleID()
+		return nil
+	}, 1, world)
+	assert.NoError(t, err)
+
+	tc := newTestCase(&messages.Pickle{Id: "id"}, nil)
+	tc.world = &testWorld{}
+
+	err = h.call(context.Background(), tc, []interface{}{"foo"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &testWorld{Value: "fooid"}, tc.World())
+
+	err = h.call(context.Background(), newTestCase(&messages.Pickle{}, nil), []interface{}{"foo"}, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "step handler expects world *cucumber.testWorld but scenario has none", err.Error())
+	}
+}